@@ -1,7 +1,24 @@
 // ===== CONFIG =====
-const DIRECTORY_URL = `https://directory-speedtest.noobhomelab.icu`; // ganti kalau perlu
-const DEFAULT_SECONDS = 10;
-const DEFAULT_STREAMS = 8;
+// Default; ditimpa config.json (file statis di nginx, atau disajikan node kalau web client di-embed)
+let DIRECTORY_URL = `https://directory-speedtest.noobhomelab.icu`; // "" = tes ke node yang menyajikan halaman ini
+let DEFAULT_SECONDS = 10;
+let DEFAULT_STREAMS = 8;
+let MAX_SECONDS = 30;
+let MAX_STREAMS = 32;
+
+async function loadConfig(){
+  try{
+    const r = await fetch("config.json", { cache:"no-store" });
+    if (!r.ok) return;
+    const c = await r.json();
+    if (typeof c.directoryUrl === "string") DIRECTORY_URL = c.directoryUrl.replace(/\/+$/,"");
+    if (c.maxSeconds > 0) MAX_SECONDS = c.maxSeconds;
+    if (c.maxStreams > 0) MAX_STREAMS = c.maxStreams;
+    if (c.defaultSeconds > 0) DEFAULT_SECONDS = Math.min(c.defaultSeconds, MAX_SECONDS);
+    if (c.defaultStreams > 0) DEFAULT_STREAMS = Math.min(c.defaultStreams, MAX_STREAMS);
+  }catch(e){ console.warn("config.json tidak terbaca, pakai default:", e); }
+}
+const configReady = loadConfig();
 
 // ===== DOM & STATE =====
 const $ = (id) => document.getElementById(id);
@@ -257,20 +274,18 @@ function ensureBadges(){
   }
 }
 
-async function getClientNetworkInfo(){
+// IP & ISP dari node yang dipilih (/api/v1/whoami), tanpa layanan pihak ketiga
+async function getClientNetworkInfo(baseUrl){
+  if (!baseUrl) return;
   try{
-    const r = await fetch("https://ipapi.co/json/");
+    const r = await fetch(baseUrl + "/api/v1/whoami", { cache:"no-store" });
     const j = await r.json();
     if (j?.ip) $("clientIpText").textContent = `IP: ${j.ip}`;
-    const isp = j.org || j.isp || (j.asn ? (j.asn + (j.asn_org ? " " + j.asn_org : "")) : null);
+    let isp = j.org ? (j.asn ? `AS${j.asn} ${j.org}` : j.org) : null;
+    if (!isp && j.cgnat) isp = "CGNAT";
+    if (!isp && j.private) isp = "jaringan lokal";
     if (isp) $("clientIspText").textContent = `— ISP: ${isp}`;
-  }catch(e){
-    try{
-      const r2 = await fetch("https://api.ipify.org?format=json");
-      const j2 = await r2.json();
-      if (j2?.ip) $("clientIpText").textContent = `IP: ${j2.ip}`;
-    }catch(_){}
-  }
+  }catch(e){ log("whoami error:", e); }
 }
 function updateServerDisplay(s){
   const txt = $("serverText");
@@ -306,11 +321,23 @@ async function measureLatency(baseUrl, count=4, timeoutMs=1500){
   const jitter=Math.sqrt(samples.reduce((s,x)=>s+Math.pow(x-mean,2),0)/samples.length);
   return { avg, jitter };
 }
+// tanpa directory: node yang menyajikan halaman ini (same-origin, tanpa CORS)
+async function selfServer(){
+  const s = { id: "local", url: location.origin };
+  try{
+    const c = await (await fetch("/api/v1/config", { cache:"no-store" })).json();
+    s.id = c.nodeId || s.id; s.region = c.region;
+  }catch{}
+  return s;
+}
 async function autoSelectServer(){
   let list=[];
   try{
-    const r = await fetch(DIRECTORY_URL + "/api/v1/servers", { cache:"no-store" });
-    list = await r.json();
+    if (!DIRECTORY_URL) list = [await selfServer()];
+    else {
+      const r = await fetch(DIRECTORY_URL + "/api/v1/servers", { cache:"no-store" });
+      list = await r.json();
+    }
   }catch(e){ log("Directory error:", e); return; }
 
   const candidates = (Array.isArray(list)?list:[]).map(s=>({ ...s, url: normalizeNodeUrl(s) })).filter(s=>s.url);
@@ -376,8 +403,23 @@ async function runUploadFallback(baseUrl, seconds=DEFAULT_SECONDS, streams=Math.
   const worker=async()=>{ let sent=0; while(Date.now()<tEnd && !state.stopFlag){ await fetch(baseUrl+"/api/v1/upload",{method:"POST",headers:{"Content-Type":"application/octet-stream"},body:UP_CHUNK}).catch(()=>{}); sent+=UP_CHUNK.length; total+=UP_CHUNK.length; onProgress(total); } return sent; };
   const tick=setInterval(()=>onProgress(total),120); const results=await Promise.all(Array.from({length:streams}, worker)); clearInterval(tick); onProgress(total); return results.reduce((a,b)=>a+b,0);
 }
+// Upload lewat WebSocket: kontinu tanpa streaming fetch, progress dihitung server
+function wsUrl(baseUrl, path){ return baseUrl.replace(/^http/, "ws") + path; }
+async function runUploadWS(baseUrl, seconds=DEFAULT_SECONDS, streams=DEFAULT_STREAMS, onProgress=()=>{}){
+  let total=0;
+  const worker=()=>new Promise(resolve=>{
+    let ws, got=0, timer=null; const end=Date.now()+seconds*1000;
+    try{ ws=new WebSocket(wsUrl(baseUrl, `/api/v1/ws?mode=upload&time=${seconds}`)); }catch{ return resolve(0); }
+    const pump=()=>{ if(Date.now()>=end||state.stopFlag){ clearInterval(timer); timer=null; try{ ws.send(JSON.stringify({type:"done"})); }catch{} return; } while(ws.bufferedAmount < 4*UP_CHUNK.length) ws.send(UP_CHUNK); };
+    ws.onopen=()=>{ timer=setInterval(pump, 20); pump(); };
+    ws.onmessage=(ev)=>{ try{ const j=JSON.parse(ev.data); if(typeof j.receivedBytes==="number"){ total+=j.receivedBytes-got; got=j.receivedBytes; onProgress(total); } if(j.type==="result") ws.close(); }catch{} };
+    ws.onclose=()=>{ if(timer) clearInterval(timer); resolve(got); };
+  });
+  const results=await Promise.all(Array.from({length:streams}, worker)); return results.reduce((a,b)=>a+b,0);
+}
 async function runUpload(baseUrl, seconds=DEFAULT_SECONDS, streams=DEFAULT_STREAMS, onProgress=()=>{}){
   if (supportsStreamingUpload()){ const sum=await runUploadStreaming(baseUrl,seconds,streams,onProgress); if(sum>0) return sum; log("Streaming returned 0 → fallback"); }
+  if ("WebSocket" in window){ const sum=await runUploadWS(baseUrl,seconds,streams,onProgress); if(sum>0) return sum; log("WebSocket upload returned 0 → fallback"); }
   return await runUploadFallback(baseUrl, seconds, Math.max(1, Math.min(8, streams)), onProgress);
 }
 
@@ -385,6 +427,7 @@ async function runUpload(baseUrl, seconds=DEFAULT_SECONDS, streams=DEFAULT_STREA
 function setRunning(r){ if($("btnStart")) $("btnStart").disabled=r; if($("btnStop")) $("btnStop").disabled=!r; }
 
 async function startTest(){
+  await configReady;
   if (!state.selected){ await autoSelectServer(); if (!state.selected){ alert("Tidak ada server tersedia."); return; } }
   setRunning(true); state.stopFlag=false;
   if($("downBar")) $("downBar").style.width="0%";
@@ -396,8 +439,8 @@ async function startTest(){
   updateGauge(0);
 
   const base = state.selected.URL || state.selected.url;
-  const seconds = Math.max(3, Math.min(30, readIntOrDefault("duration", DEFAULT_SECONDS)));
-  const streams = Math.max(1, Math.min(32, readIntOrDefault("streams", DEFAULT_STREAMS)));
+  const seconds = Math.max(3, Math.min(MAX_SECONDS, readIntOrDefault("duration", DEFAULT_SECONDS)));
+  const streams = Math.max(1, Math.min(MAX_STREAMS, readIntOrDefault("streams", DEFAULT_STREAMS)));
 
   // latency
   try{
@@ -466,8 +509,8 @@ window.addEventListener("DOMContentLoaded", ()=>{
   if (!shared) {
     // Hanya jalankan auto-discovery jika tidak memuat dari link
     ensureBadges();          // buat badge server & IP/ISP kalau belum ada
-    getClientNetworkInfo();  // isi IP & ISP
-    autoSelectServer();      // pilih server otomatis + isi badge server
+    // pilih server otomatis + isi badge server, lalu IP & ISP dari node tersebut
+    configReady.then(autoSelectServer).then(()=> getClientNetworkInfo(normalizeNodeUrl(state.selected || {})));
   } else {
     // Jika memuat dari link, aktifkan tombol share/download
     document.getElementById("btnShare").disabled = false;
@@ -3,9 +3,11 @@ package main
 
 import (
 	"context"
+	"crypto/subtle"
 	"database/sql"
 	"encoding/json"
 	"errors"
+	"io"
 	"log"
 	"net"
 	"net/http"
@@ -19,16 +21,19 @@ import (
 )
 
 type ServerRow struct {
-	ID            string     `json:"id"`
-	Region        string     `json:"region"`
-	City          string     `json:"city"`
-	URL           string     `json:"url"`
-	Status        string     `json:"status"` // UP | DOWN | UNKNOWN
-	Load          float64    `json:"load"`
-	LastPingAt    *time.Time `json:"lastPingAt,omitempty"`
-	LastLatencyMs *float64   `json:"lastLatencyMs,omitempty"`
-	CreatedAt     time.Time  `json:"-"`
-	UpdatedAt     time.Time  `json:"-"`
+	ID              string          `json:"id"`
+	Region          string          `json:"region"`
+	City            string          `json:"city"`
+	URL             string          `json:"url"`
+	Status          string          `json:"status"` // UP | DOWN | DRAINING | UNKNOWN
+	Load            float64         `json:"load"`
+	LastPingAt      *time.Time      `json:"lastPingAt,omitempty"`
+	LastLatencyMs   *float64        `json:"lastLatencyMs,omitempty"`
+	Capabilities    []string        `json:"capabilities,omitempty"`
+	LastHeartbeatAt *time.Time      `json:"lastHeartbeatAt,omitempty"` // hanya node yang self-register
+	Stats           json.RawMessage `json:"stats,omitempty"`           // isi heartbeat terakhir
+	CreatedAt       time.Time       `json:"-"`
+	UpdatedAt       time.Time       `json:"-"`
 }
 
 var (
@@ -39,6 +44,9 @@ var (
 	httpClient  *http.Client
 	bindAddr    string
 	adminOrigin string
+	nodeToken   string
+	nodeTokens  map[string]string // NODE_TOKENS: id -> token milik node itu saja
+	hbTimeout   time.Duration
 )
 
 func getenv(k, d string) string {
@@ -49,12 +57,27 @@ func getenv(k, d string) string {
 }
 
 func main() {
+	var err error
 	// === Config ===
 	adminToken = getenv("ADMIN_TOKEN", "changeme-admin-token")
 	publicCORS = getenv("PUBLIC_CORS_ORIGIN", "*")                       // origin yang boleh GET servers
 	adminOrigin = getenv("ADMIN_CORS_ORIGIN", "*")                       // origin dashboard
 	pingEvery = time.Duration(mustParseInt(getenv("PING_INTERVAL_SEC", "60"))) * time.Second
 	bindAddr = getenv("BIND_ADDR", ":9088")                              // default sama seperti dir lama
+	nodeToken = getenv("NODE_TOKEN", "")                                 // kredensial bersama semua node (lama)
+	nodeTokens, err = parseNodeTokens(getenv("NODE_TOKENS", ""))         // "node-dps=secret1,node-jkt=secret2"
+	must(err)
+	if nodeToken != "" {
+		log.Println("NODE_TOKEN is shared by all nodes; set NODE_TOKENS to bind each node id to its own token")
+	}
+	hbTimeout = time.Duration(mustParseInt(getenv("HEARTBEAT_TIMEOUT_SEC", "45"))) * time.Second
+	// ticker reaper = timeout/3 dan ping worker tidak boleh 0
+	if hbTimeout < 3*time.Second {
+		log.Fatalf("HEARTBEAT_TIMEOUT_SEC must be >= 3 (got %s)", hbTimeout)
+	}
+	if pingEvery <= 0 {
+		log.Fatalf("PING_INTERVAL_SEC must be > 0")
+	}
 	dsn := getenv("SQLITE_DSN", "file:data/dir.db?_pragma=busy_timeout=5000&_pragma=journal_mode(WAL)")
 	_ = os.MkdirAll("data", 0755)
 
@@ -74,7 +97,6 @@ func main() {
 	}
 
 	// === DB ===
-	var err error
 	db, err = sql.Open("sqlite", dsn)
 	must(err)
 	must(migrate())
@@ -99,10 +121,15 @@ func main() {
 		api.With(cors(adminOrigin), bearerAuth).Post("/servers", apiCreateServer)
 		api.With(cors(adminOrigin), bearerAuth).Put("/servers/{id}", apiUpdateServer)
 		api.With(cors(adminOrigin), bearerAuth).Delete("/servers/{id}", apiDeleteServer)
+
+		// node self-registration (node token)
+		api.With(nodeAuth).Post("/nodes/register", apiRegisterNode)
+		api.With(nodeAuth).Post("/nodes/{id}/heartbeat", apiNodeHeartbeat)
 	})
 
 	// === Ping worker ===
 	go pingWorker(context.Background(), pingEvery)
+	go heartbeatReaper(context.Background(), hbTimeout)
 
 	log.Printf("Directory service up on %s (ping interval %s)\n", bindAddr, pingEvery)
 	must(http.ListenAndServe(bindAddr, r))
@@ -125,7 +152,35 @@ CREATE TABLE IF NOT EXISTS servers(
 );
 CREATE INDEX IF NOT EXISTS idx_servers_status ON servers(status);
 `
-	_, err := db.Exec(sqlStmt)
+	if _, err := db.Exec(sqlStmt); err != nil {
+		return err
+	}
+	// kolom tambahan untuk node yang self-register
+	if err := addColumnIfMissing("servers", "capabilities", "TEXT NOT NULL DEFAULT ''"); err != nil {
+		return err
+	}
+	if err := addColumnIfMissing("servers", "last_heartbeat_at", "TIMESTAMP NULL"); err != nil {
+		return err
+	}
+	return addColumnIfMissing("servers", "stats", "TEXT NULL")
+}
+
+func addColumnIfMissing(table, col, decl string) error {
+	rows, err := db.Query(`SELECT name FROM pragma_table_info(?)`, table)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return err
+		}
+		if name == col {
+			return nil
+		}
+	}
+	_, err = db.Exec(`ALTER TABLE ` + table + ` ADD COLUMN ` + col + ` ` + decl)
 	return err
 }
 
@@ -213,36 +268,105 @@ func bearerAuth(next http.Handler) http.Handler {
 	})
 }
 
+// parseNodeTokens: NODE_TOKENS="id=token,id2=token2".
+func parseNodeTokens(s string) (map[string]string, error) {
+	out := map[string]string{}
+	for _, e := range strings.Split(s, ",") {
+		if e = strings.TrimSpace(e); e == "" {
+			continue
+		}
+		id, tok, ok := strings.Cut(e, "=")
+		id, tok = strings.TrimSpace(id), strings.TrimSpace(tok)
+		if !ok || id == "" || tok == "" {
+			return nil, errors.New("NODE_TOKENS: entries must be id=token")
+		}
+		out[id] = tok
+	}
+	return out, nil
+}
+
+func bearerToken(r *http.Request) string {
+	h := r.Header.Get("Authorization")
+	if !strings.HasPrefix(h, "Bearer ") {
+		return ""
+	}
+	return strings.TrimSpace(h[len("Bearer "):])
+}
+
+func tokenEqual(a, b string) bool {
+	return a != "" && subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
+}
+
+// nodeAuth: token harus salah satu kredensial node; apakah token itu boleh dipakai
+// untuk id tertentu dicek di handler (nodeCredential), karena id register ada di body.
+func nodeAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tok := bearerToken(r)
+		ok := tokenEqual(tok, nodeToken)
+		for _, t := range nodeTokens {
+			ok = ok || tokenEqual(tok, t)
+		}
+		if !ok {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// nodeCredential: "own" kalau token adalah token milik id ini (NODE_TOKENS), "shared" kalau
+// NODE_TOKEN bersama dan id tidak punya token sendiri, "" kalau token tidak boleh untuk id ini.
+func nodeCredential(r *http.Request, id string) string {
+	tok := bearerToken(r)
+	if own, ok := nodeTokens[id]; ok {
+		if tokenEqual(tok, own) {
+			return "own"
+		}
+		return ""
+	}
+	if tokenEqual(tok, nodeToken) {
+		return "shared"
+	}
+	return ""
+}
+
 // ---------- API HANDLERS ----------
 func apiListActiveServers(w http.ResponseWriter, r *http.Request) {
-	rows, err := db.Query(`SELECT id,region,city,url,status,load FROM servers WHERE status='UP' ORDER BY load ASC, last_latency_ms ASC NULLS LAST, updated_at DESC`)
+	rows, err := db.Query(`SELECT id,region,city,url,status,load,capabilities FROM servers WHERE status='UP' ORDER BY load ASC, last_latency_ms ASC NULLS LAST, updated_at DESC`)
 	if err != nil { http.Error(w, err.Error(), 500); return }
 	defer rows.Close()
 	var out []ServerRow
 	for rows.Next() {
 		var s ServerRow
-		if err := rows.Scan(&s.ID, &s.Region, &s.City, &s.URL, &s.Status, &s.Load); err != nil {
+		var caps string
+		if err := rows.Scan(&s.ID, &s.Region, &s.City, &s.URL, &s.Status, &s.Load, &caps); err != nil {
 			http.Error(w, err.Error(), 500); return
 		}
+		s.Capabilities = splitCaps(caps)
 		out = append(out, s)
 	}
 	writeJSON(w, out)
 }
 
 func apiListAllServers(w http.ResponseWriter, r *http.Request) {
-	rows, err := db.Query(`SELECT id,region,city,url,status,load,last_ping_at,last_latency_ms,created_at,updated_at FROM servers ORDER BY updated_at DESC`)
+	rows, err := db.Query(`SELECT id,region,city,url,status,load,last_ping_at,last_latency_ms,capabilities,last_heartbeat_at,stats,created_at,updated_at FROM servers ORDER BY updated_at DESC`)
 	if err != nil { http.Error(w, err.Error(), 500); return }
 	defer rows.Close()
 	var out []ServerRow
 	for rows.Next() {
 		var s ServerRow
-		var lpa sql.NullTime
+		var lpa, lhb sql.NullTime
 		var lat sql.NullFloat64
-		if err := rows.Scan(&s.ID,&s.Region,&s.City,&s.URL,&s.Status,&s.Load,&lpa,&lat,&s.CreatedAt,&s.UpdatedAt); err != nil {
+		var caps string
+		var stats sql.NullString
+		if err := rows.Scan(&s.ID,&s.Region,&s.City,&s.URL,&s.Status,&s.Load,&lpa,&lat,&caps,&lhb,&stats,&s.CreatedAt,&s.UpdatedAt); err != nil {
 			http.Error(w, err.Error(), 500); return
 		}
 		if lpa.Valid { s.LastPingAt = &lpa.Time }
 		if lat.Valid { v := lat.Float64; s.LastLatencyMs = &v }
+		if lhb.Valid { s.LastHeartbeatAt = &lhb.Time }
+		if stats.Valid && stats.String != "" { s.Stats = json.RawMessage(stats.String) }
+		s.Capabilities = splitCaps(caps)
 		out = append(out, s)
 	}
 	writeJSON(w, out)
@@ -298,14 +422,85 @@ func apiDeleteServer(w http.ResponseWriter, r *http.Request) {
 	writeJSON(w, map[string]any{"ok": true})
 }
 
+// ---------- NODE SELF-REGISTRATION ----------
+type nodeRegistration struct {
+	ID           string   `json:"id"`
+	Region       string   `json:"region"`
+	City         string   `json:"city"`
+	URL          string   `json:"url"`
+	Capabilities []string `json:"capabilities"`
+}
+
+func apiRegisterNode(w http.ResponseWriter, r *http.Request) {
+	var in nodeRegistration
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil { http.Error(w, "bad json", 400); return }
+	in.ID = strings.TrimSpace(in.ID)
+	in.URL = strings.TrimRight(strings.TrimSpace(in.URL), "/")
+	if in.City == "" { in.City = in.Region }
+	if in.ID == "" || in.URL == "" || in.Region == "" {
+		http.Error(w, "id, region, url required", 400); return
+	}
+	cred := nodeCredential(r, in.ID)
+	if cred == "" { http.Error(w, "token not valid for this node id", http.StatusForbidden); return }
+	if cred == "shared" {
+		// token bersama tidak boleh membelokkan url node/server lain yang sudah ada
+		var cur string
+		err := db.QueryRow(`SELECT url FROM servers WHERE id=?`, in.ID).Scan(&cur)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) { http.Error(w, err.Error(), 500); return }
+		if err == nil && cur != in.URL {
+			http.Error(w, "url change for an existing node needs its own token (NODE_TOKENS)", http.StatusConflict); return
+		}
+	}
+	// upsert: node yang restart cukup register ulang
+	if _, err := db.Exec(`INSERT INTO servers (id,region,city,url,status,capabilities,last_heartbeat_at) VALUES (?,?,?,?,'UP',?,?)
+ON CONFLICT(id) DO UPDATE SET region=excluded.region, city=excluded.city, url=excluded.url, status='UP',
+  capabilities=excluded.capabilities, last_heartbeat_at=excluded.last_heartbeat_at, updated_at=CURRENT_TIMESTAMP`,
+		in.ID, in.Region, in.City, in.URL, strings.Join(in.Capabilities, ","), nowPtr()); err != nil {
+		// url UNIQUE: url yang sama sudah dipakai id lain
+		http.Error(w, err.Error(), http.StatusConflict); return
+	}
+	log.Printf("node registered: %s (%s) %s", in.ID, in.Region, in.URL)
+	writeJSON(w, map[string]any{"ok": true, "heartbeatTimeoutSec": int(hbTimeout / time.Second)})
+}
+
+func apiNodeHeartbeat(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	if nodeCredential(r, id) == "" { http.Error(w, "token not valid for this node id", http.StatusForbidden); return }
+	var stats json.RawMessage
+	if err := json.NewDecoder(r.Body).Decode(&stats); err != nil { http.Error(w, "bad json", 400); return }
+	// load real-time dari node (kalau ada) menggantikan nilai manual
+	var hb struct {
+		Load  *float64 `json:"load"`
+		State string   `json:"state"`
+	}
+	_ = json.Unmarshal(stats, &hb)
+	// node yang sedang drain (mau restart/deploy) atau maintenance keluar dari /servers tapi belum DOWN
+	status := "UP"
+	if hb.State == "draining" || hb.State == "maintenance" { status = "DRAINING" }
+	res, err := db.Exec(`UPDATE servers SET status=?, last_heartbeat_at=?, stats=?, load=COALESCE(?, load), updated_at=CURRENT_TIMESTAMP WHERE id=?`,
+		status, nowPtr(), string(stats), nullableLoad(hb.Load), id)
+	if err != nil { http.Error(w, err.Error(), 500); return }
+	if n, _ := res.RowsAffected(); n == 0 {
+		// node belum/tidak terdaftar lagi → node harus register ulang
+		http.Error(w, "unknown node", http.StatusNotFound); return
+	}
+	writeJSON(w, map[string]any{"ok": true})
+}
+
+func splitCaps(s string) []string {
+	if s == "" { return nil }
+	return strings.Split(s, ",")
+}
+
 func apiHealth(w http.ResponseWriter, r *http.Request) {
-	var up, down int
+	var up, down, drainingN int
 	_ = db.QueryRow(`SELECT COUNT(*) FROM servers WHERE status='UP'`).Scan(&up)
 	_ = db.QueryRow(`SELECT COUNT(*) FROM servers WHERE status='DOWN'`).Scan(&down)
+	_ = db.QueryRow(`SELECT COUNT(*) FROM servers WHERE status='DRAINING'`).Scan(&drainingN)
 	var last time.Time
 	_ = db.QueryRow(`SELECT COALESCE(MAX(last_ping_at), '1970-01-01') FROM servers`).Scan(&last)
 	writeJSON(w, map[string]any{
-		"up": up, "down": down, "lastPingAt": last.UTC(),
+		"up": up, "down": down, "draining": drainingN, "lastPingAt": last.UTC(),
 	})
 }
 
@@ -330,8 +525,28 @@ func pingWorker(ctx context.Context, every time.Duration) {
 	}
 }
 
+// heartbeatReaper: node self-register yang berhenti heartbeat → DOWN.
+// Ini juga berlaku untuk node di belakang NAT yang tidak bisa di-ping directory.
+func heartbeatReaper(ctx context.Context, timeout time.Duration) {
+	t := time.NewTicker(timeout / 3)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			cutoff := time.Now().UTC().Add(-timeout)
+			res, err := db.Exec(`UPDATE servers SET status='DOWN', updated_at=CURRENT_TIMESTAMP WHERE last_heartbeat_at IS NOT NULL AND last_heartbeat_at < ? AND status!='DOWN'`, cutoff)
+			if err != nil { log.Println("heartbeat reaper:", err); continue }
+			if n, _ := res.RowsAffected(); n > 0 { log.Printf("heartbeat reaper: %d node(s) marked DOWN", n) }
+		}
+	}
+}
+
 func pingAllOnce() {
-	rows, err := db.Query(`SELECT id,url FROM servers`)
+	// node yang heartbeat tidak di-ping; statusnya diatur heartbeatReaper
+	rows, err := db.Query(`SELECT id,url FROM servers WHERE last_heartbeat_at IS NULL`)
 	if err != nil { log.Println("ping list:", err); return }
 	defer rows.Close()
 
@@ -351,9 +566,11 @@ func pingAllOnce() {
 			defer func(){ <-sem }()
 			latMs, ok := measureLatency(it.url)
 			status := "DOWN"
-			if ok { status = "UP" }
-			_, _ = db.Exec(`UPDATE servers SET status=?, last_ping_at=?, last_latency_ms=?, updated_at=CURRENT_TIMESTAMP WHERE id=?`,
-				status, nowPtr(), nullableFloat(latMs), it.id)
+			var load *float64
+			if ok { status = "UP"; load = fetchLoad(it.url) }
+			if ok && nodeDraining(it.url) { status = "DRAINING" }
+			_, _ = db.Exec(`UPDATE servers SET status=?, last_ping_at=?, last_latency_ms=?, load=COALESCE(?, load), updated_at=CURRENT_TIMESTAMP WHERE id=?`,
+				status, nowPtr(), nullableFloat(latMs), nullableLoad(load), it.id)
 		}(it)
 	}
 	// drain
@@ -372,6 +589,34 @@ func measureLatency(base string) (float64, bool) {
 	return 0, false
 }
 
+// nodeDraining: /healthz node menjawab 503 "draining" (graceful shutdown) atau "maintenance".
+func nodeDraining(base string) bool {
+	resp, err := httpClient.Get(strings.TrimRight(base, "/") + "/healthz")
+	if err != nil { return false }
+	defer resp.Body.Close()
+	b, _ := io.ReadAll(io.LimitReader(resp.Body, 64))
+	state := strings.TrimSpace(string(b))
+	return resp.StatusCode == http.StatusServiceUnavailable && (state == "draining" || state == "maintenance")
+}
+
+// fetchLoad membaca load real-time dari /api/v1/config node (nil kalau node lama/tidak ada).
+func fetchLoad(base string) *float64 {
+	resp, err := httpClient.Get(strings.TrimRight(base, "/") + "/api/v1/config")
+	if err != nil { return nil }
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK { return nil }
+	var cfg struct {
+		Load *float64 `json:"load"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&cfg); err != nil { return nil }
+	return cfg.Load
+}
+
+func nullableLoad(v *float64) any {
+	if v == nil { return nil }
+	return *v
+}
+
 func nullableFloat(v float64) any {
 	if v == 0 { return nil }
 	return v
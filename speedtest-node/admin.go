@@ -0,0 +1,172 @@
+package main
+
+import (
+  "crypto/subtle"
+  "encoding/json"
+  "errors"
+  "log"
+  "net/http"
+  "strings"
+  "sync"
+  "syscall"
+)
+
+// Admin API (Bearer ADMIN_TOKEN; kosong = nonaktif): ubah limits, maintenance/drain,
+// dan lihat/kill sesi tanpa restart container. Perubahan langsung terlihat di /api/v1/config.
+//
+//   GET        /api/v1/admin/status
+//   GET|PUT    /api/v1/admin/limits          PUT: field yang dikirim saja yang diubah
+//   GET|PUT    /api/v1/admin/maintenance     {"enabled":true|false}
+//   POST       /api/v1/admin/drain           sama dengan SIGTERM (drain lalu shutdown)
+//   GET        /api/v1/admin/sessions
+//   GET|DELETE /api/v1/admin/sessions/{id}   DELETE = kill (stream yang jalan diputus)
+
+func registerAdmin(mux *http.ServeMux, token string) {
+  auth := func(h http.HandlerFunc) http.HandlerFunc { return withCORS(withAdminAuth(token, h)) }
+  mux.HandleFunc("/api/v1/admin/status", auth(adminStatus))
+  mux.HandleFunc("/api/v1/admin/limits", auth(adminLimits))
+  mux.HandleFunc("/api/v1/admin/maintenance", auth(adminMaintenance))
+  mux.HandleFunc("/api/v1/admin/drain", auth(adminDrain))
+  mux.HandleFunc("/api/v1/admin/sessions", auth(adminSessions))
+  mux.HandleFunc("/api/v1/admin/sessions/{id}", auth(adminSession))
+}
+
+func withAdminAuth(token string, h http.HandlerFunc) http.HandlerFunc {
+  return func(w http.ResponseWriter, r *http.Request) {
+    got, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+    if !ok || subtle.ConstantTimeCompare([]byte(strings.TrimSpace(got)), []byte(token)) != 1 {
+      http.Error(w, "unauthorized", http.StatusUnauthorized)
+      return
+    }
+    h(w, r)
+  }
+}
+
+func adminJSON(w http.ResponseWriter, v any) {
+  w.Header().Set("Content-Type", "application/json")
+  w.Header().Set("Cache-Control", "no-store")
+  _ = json.NewEncoder(w).Encode(v)
+}
+
+func adminStatus(w http.ResponseWriter, r *http.Request) {
+  if r.Method != http.MethodGet { http.Error(w, "method not allowed", http.StatusMethodNotAllowed); return }
+  adminJSON(w, map[string]any{
+    "state": nodeState(), "limits": limits.Load(), "activeStreams": admit.active(),
+    "sessions": sessions.count(), "load": currentLoad(), "capabilities": capabilities(),
+  })
+}
+
+// ---------- limits ----------
+
+var limitsMu sync.Mutex // serialisasi read-modify-write PUT limits
+
+type limitsPatch struct {
+  MaxStreams     *int   `json:"maxStreams"`
+  MaxNodeStreams *int   `json:"maxNodeStreams"`
+  MaxDurationSec *int   `json:"maxDurationSec"`
+  MaxStreamBytes *int64 `json:"maxStreamBytes"`
+  RetryAfterSec  *int   `json:"retryAfterSec"`
+}
+
+func (p limitsPatch) apply(l limitsConfig) (limitsConfig, error) {
+  set := func(dst *int, v *int, name string) error {
+    if v == nil { return nil }
+    if *v <= 0 { return errors.New(name + " must be > 0") }
+    *dst = *v
+    return nil
+  }
+  if err := errors.Join(
+    set(&l.MaxStreams, p.MaxStreams, "maxStreams"),
+    set(&l.MaxNodeStreams, p.MaxNodeStreams, "maxNodeStreams"),
+    set(&l.MaxDurationSec, p.MaxDurationSec, "maxDurationSec"),
+    set(&l.RetryAfterSec, p.RetryAfterSec, "retryAfterSec"),
+  ); err != nil {
+    return l, err
+  }
+  if p.MaxStreamBytes != nil {
+    if *p.MaxStreamBytes <= 0 { return l, errors.New("maxStreamBytes must be > 0") }
+    l.MaxStreamBytes = *p.MaxStreamBytes
+  }
+  if l.MaxStreams > l.MaxNodeStreams { return l, errors.New("maxStreams must be <= maxNodeStreams") }
+  return l, nil
+}
+
+func adminLimits(w http.ResponseWriter, r *http.Request) {
+  switch r.Method {
+  case http.MethodGet:
+  case http.MethodPut:
+    var p limitsPatch
+    dec := json.NewDecoder(r.Body)
+    dec.DisallowUnknownFields()
+    if err := dec.Decode(&p); err != nil { http.Error(w, "bad json: "+err.Error(), http.StatusBadRequest); return }
+    limitsMu.Lock()
+    next, err := p.apply(*limits.Load())
+    if err == nil { limits.Store(&next) }
+    limitsMu.Unlock()
+    if err != nil { http.Error(w, err.Error(), http.StatusBadRequest); return }
+    log.Printf("admin: limits changed to %+v", next)
+  default:
+    http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+    return
+  }
+  adminJSON(w, limits.Load())
+}
+
+// ---------- maintenance / drain ----------
+
+func adminMaintenance(w http.ResponseWriter, r *http.Request) {
+  switch r.Method {
+  case http.MethodGet:
+  case http.MethodPut, http.MethodPost:
+    var in struct {
+      Enabled *bool `json:"enabled"`
+    }
+    if err := json.NewDecoder(r.Body).Decode(&in); err != nil || in.Enabled == nil {
+      http.Error(w, `body must be {"enabled":true|false}`, http.StatusBadRequest)
+      return
+    }
+    if maintenance.Swap(*in.Enabled) != *in.Enabled {
+      log.Printf("admin: maintenance %v", *in.Enabled)
+      if dirRegistrar != nil { go dirRegistrar.heartbeat() } // directory langsung tahu
+    }
+  default:
+    http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+    return
+  }
+  adminJSON(w, map[string]any{"maintenance": maintenance.Load(), "state": nodeState()})
+}
+
+func adminDrain(w http.ResponseWriter, r *http.Request) {
+  if r.Method != http.MethodPost { http.Error(w, "method not allowed", http.StatusMethodNotAllowed); return }
+  select {
+  case shutdownc <- syscall.SIGTERM:
+    log.Printf("admin: drain requested")
+  default: // sudah ada permintaan shutdown yang antre
+  }
+  w.Header().Set("Content-Type", "application/json")
+  w.WriteHeader(http.StatusAccepted)
+  _ = json.NewEncoder(w).Encode(map[string]any{"state": "draining"})
+}
+
+// ---------- sessions ----------
+
+func adminSessions(w http.ResponseWriter, r *http.Request) {
+  if r.Method != http.MethodGet { http.Error(w, "method not allowed", http.StatusMethodNotAllowed); return }
+  adminJSON(w, sessions.list())
+}
+
+func adminSession(w http.ResponseWriter, r *http.Request) {
+  id := r.PathValue("id")
+  switch r.Method {
+  case http.MethodGet:
+    ss := sessions.get(id)
+    if ss == nil { http.Error(w, "session not found", http.StatusNotFound); return }
+    adminJSON(w, ss.summary())
+  case http.MethodDelete:
+    if !sessions.kill(id) { http.Error(w, "session not found", http.StatusNotFound); return }
+    log.Printf("admin: session %s killed", id)
+    adminJSON(w, map[string]any{"killed": id})
+  default:
+    http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+  }
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+  "errors"
+  "fmt"
+  "net/http"
+  "slices"
+  "strings"
+)
+
+// cc= di /api/v1/download: pilih TCP congestion control (cubic vs bbr, dst) per stream.
+// Hanya algoritma di TCP_CC_ALLOWED yang juga tersedia di kernel.
+
+var ccAlgos []string // diisi loadCongestionControls() saat start
+
+func loadCongestionControls() []string {
+  avail := availableCC()
+  var out []string
+  for _, a := range strings.Split(getenv("TCP_CC_ALLOWED", "cubic,bbr,reno"), ",") {
+    a = strings.TrimSpace(a)
+    if a != "" && slices.Contains(avail, a) && !slices.Contains(out, a) { out = append(out, a) }
+  }
+  return out
+}
+
+// applyCC memasang algoritma di socket request; restore mengembalikan yang lama
+// (koneksi keep-alive dipakai lagi oleh request berikutnya).
+func applyCC(r *http.Request, name string) (applied string, restore func(), err error) {
+  if len(ccAlgos) == 0 { return "", nil, errors.New("cc= is not supported on this node") }
+  if !slices.Contains(ccAlgos, name) {
+    return "", nil, fmt.Errorf("cc must be one of: %s", strings.Join(ccAlgos, ", "))
+  }
+  // h2 memakai satu koneksi untuk banyak stream, jadi cc= tidak bisa per stream
+  if r.ProtoMajor != 1 { return "", nil, errors.New("cc= needs HTTP/1.1 (one stream per TCP connection)") }
+  c := requestTCPConn(r)
+  if c == nil { return "", nil, errors.New("cc= needs a TCP connection") }
+  prev := getCC(c)
+  if err := setCC(c, name); err != nil { return "", nil, fmt.Errorf("set congestion control %s: %w", name, err) }
+  return getCC(c), func() {
+    if prev != "" { _ = setCC(c, prev) }
+  }, nil
+}
@@ -0,0 +1,39 @@
+//go:build linux
+
+package main
+
+import (
+  "net"
+  "os"
+  "strings"
+
+  "golang.org/x/sys/unix"
+)
+
+func availableCC() []string {
+  b, err := os.ReadFile("/proc/sys/net/ipv4/tcp_available_congestion_control")
+  if err != nil { return nil }
+  return strings.Fields(string(b))
+}
+
+func setCC(c *net.TCPConn, name string) error {
+  raw, err := c.SyscallConn()
+  if err != nil { return err }
+  var serr error
+  if err := raw.Control(func(fd uintptr) {
+    serr = unix.SetsockoptString(int(fd), unix.IPPROTO_TCP, unix.TCP_CONGESTION, name)
+  }); err != nil {
+    return err
+  }
+  return serr
+}
+
+func getCC(c *net.TCPConn) string {
+  raw, err := c.SyscallConn()
+  if err != nil { return "" }
+  var name string
+  _ = raw.Control(func(fd uintptr) {
+    name, _ = unix.GetsockoptString(int(fd), unix.IPPROTO_TCP, unix.TCP_CONGESTION)
+  })
+  return name
+}
@@ -0,0 +1,15 @@
+//go:build !linux
+
+package main
+
+import (
+  "errors"
+  "net"
+)
+
+// TCP_CONGESTION hanya diatur di Linux.
+func availableCC() []string { return nil }
+
+func setCC(*net.TCPConn, string) error { return errors.New("not supported") }
+
+func getCC(*net.TCPConn) string { return "" }
@@ -0,0 +1,381 @@
+package main
+
+import (
+  "bytes"
+  "encoding/json"
+  "errors"
+  "fmt"
+  "io"
+  "log"
+  "net"
+  "net/url"
+  "os"
+  "os/signal"
+  "path/filepath"
+  "reflect"
+  "slices"
+  "strconv"
+  "strings"
+  "sync/atomic"
+  "syscall"
+  "time"
+
+  "gopkg.in/yaml.v3"
+)
+
+// CONFIG_FILE: konfigurasi node dari file YAML atau JSON (.json), divalidasi saat start.
+// Tiap field punya pasangan env var lama (tag env); env yang di-set tetap menang, jadi
+// deployment yang hanya memakai env tidak berubah. Urutan: env -> file -> default.
+//
+// Validasi memakai nilai efektif (file + env yang menimpa), jadi mis. listen.http3 di file
+// dengan TLS_CERT hanya dari env tetap lolos.
+//
+// Reload saat SIGHUP atau file berubah (cek mtime tiap CONFIG_RELOAD_SEC, 0 = hanya SIGHUP).
+// Yang dibaca per request langsung dipakai: limits.maxStreams/maxNodeStreams/maxDurationSec/
+// maxStreamMb/retryAfterSec/udpMaxPps, cors.origins, node.trustedProxies dan webui.* kecuali
+// webui.enabled; sisanya (listener, TLS, identitas, protokol, sesi) dicatat di log dan butuh restart.
+
+type nodeConfig struct {
+  Node      configNode      `json:"node" yaml:"node"`
+  Listen    configListen    `json:"listen" yaml:"listen"`
+  TLS       configTLS       `json:"tls" yaml:"tls"`
+  Limits    configLimits    `json:"limits" yaml:"limits"`
+  Quota     configQuota     `json:"quota" yaml:"quota"`
+  CORS      configCORS      `json:"cors" yaml:"cors"`
+  Protocols configProtocols `json:"protocols" yaml:"protocols"`
+  Payload   configPayload   `json:"payload" yaml:"payload"`
+  WebUI     configWebUI     `json:"webui" yaml:"webui"`
+}
+
+type configNode struct {
+  ID             string   `json:"id" yaml:"id" env:"NODE_ID"`
+  Region         string   `json:"region" yaml:"region" env:"REGION"`
+  City           string   `json:"city" yaml:"city" env:"CITY"`
+  PublicURL      string   `json:"publicUrl" yaml:"publicUrl" env:"PUBLIC_URL"`
+  DirectoryURL   string   `json:"directoryUrl" yaml:"directoryUrl" env:"DIRECTORY_URL"`
+  Token          string   `json:"token" yaml:"token" env:"NODE_TOKEN"`
+  HeartbeatSec   int      `json:"heartbeatSec" yaml:"heartbeatSec" env:"HEARTBEAT_SEC"`
+  AdminToken     string   `json:"adminToken" yaml:"adminToken" env:"ADMIN_TOKEN"`
+  TrustedProxies []string `json:"trustedProxies" yaml:"trustedProxies" env:"TRUSTED_PROXIES"`
+  GeoIPDB        string   `json:"geoipDb" yaml:"geoipDb" env:"GEOIP_DB"`
+  ASNDB          string   `json:"asnDb" yaml:"asnDb" env:"ASN_DB"`
+}
+
+type configListen struct {
+  HTTP   string `json:"http" yaml:"http" env:"ADDR"`
+  HTTPS  string `json:"https" yaml:"https" env:"TLS_ADDR"`
+  HTTP3  string `json:"http3" yaml:"http3" env:"H3_ADDR"`
+  UDP    string `json:"udp" yaml:"udp" env:"UDP_ADDR"`
+  RawTCP string `json:"rawTcp" yaml:"rawTcp" env:"RAW_TCP_ADDR"`
+  Iperf3 string `json:"iperf3" yaml:"iperf3" env:"IPERF3_ADDR"`
+}
+
+type configTLS struct {
+  Cert      string `json:"cert" yaml:"cert" env:"TLS_CERT"`
+  Key       string `json:"key" yaml:"key" env:"TLS_KEY"`
+  ReloadSec int    `json:"reloadSec" yaml:"reloadSec" env:"TLS_RELOAD_SEC"`
+}
+
+type configLimits struct {
+  MaxStreams       int `json:"maxStreams" yaml:"maxStreams" env:"MAX_STREAMS"`
+  MaxNodeStreams   int `json:"maxNodeStreams" yaml:"maxNodeStreams" env:"MAX_NODE_STREAMS"`
+  MaxDurationSec   int `json:"maxDurationSec" yaml:"maxDurationSec" env:"MAX_DURATION_SEC"`
+  MaxStreamMB      int `json:"maxStreamMb" yaml:"maxStreamMb" env:"MAX_STREAM_MB"`
+  RetryAfterSec    int `json:"retryAfterSec" yaml:"retryAfterSec" env:"RETRY_AFTER_SEC"`
+  MaxSessions      int `json:"maxSessions" yaml:"maxSessions" env:"MAX_SESSIONS"`
+  MaxSessionsIP    int `json:"maxSessionsPerClient" yaml:"maxSessionsPerClient" env:"MAX_SESSIONS_PER_CLIENT"`
+  SessionTTLSec    int `json:"sessionTtlSec" yaml:"sessionTtlSec" env:"SESSION_TTL_SEC"`
+  DrainTimeoutSec  int `json:"drainTimeoutSec" yaml:"drainTimeoutSec" env:"DRAIN_TIMEOUT_SEC"`
+  LinkCapacityMbps int `json:"linkCapacityMbps" yaml:"linkCapacityMbps" env:"LINK_CAPACITY_MBPS"`
+  UDPMaxPPS        int `json:"udpMaxPps" yaml:"udpMaxPps" env:"UDP_MAX_PPS"`
+}
+
+type configQuota struct {
+  HourGB        int    `json:"egressBudgetHourGb" yaml:"egressBudgetHourGb" env:"EGRESS_BUDGET_HOUR_GB"`
+  DayGB         int    `json:"egressBudgetDayGb" yaml:"egressBudgetDayGb" env:"EGRESS_BUDGET_DAY_GB"`
+  MonthGB       int    `json:"egressBudgetMonthGb" yaml:"egressBudgetMonthGb" env:"EGRESS_BUDGET_MONTH_GB"`
+  ClientDailyMB int    `json:"clientDailyMb" yaml:"clientDailyMb" env:"CLIENT_DAILY_MB"`
+  StateFile     string `json:"stateFile" yaml:"stateFile" env:"QUOTA_STATE_FILE"`
+  FlushSec      int    `json:"flushSec" yaml:"flushSec" env:"QUOTA_FLUSH_SEC"`
+}
+
+type configCORS struct {
+  Origins []string `json:"origins" yaml:"origins" env:"CORS_ORIGINS"`
+}
+
+type configProtocols struct {
+  WebSocket         *bool    `json:"websocket" yaml:"websocket" env:"WS_ENABLED"`
+  LibreSpeed        *bool    `json:"librespeed" yaml:"librespeed" env:"LIBRESPEED_ENABLED"`
+  Files             *bool    `json:"files" yaml:"files" env:"FILES_ENABLED"`
+  Impairment        *bool    `json:"impairment" yaml:"impairment" env:"IMPAIRMENT_ENABLED"`
+  CongestionControl []string `json:"congestionControl" yaml:"congestionControl" env:"TCP_CC_ALLOWED"`
+}
+
+type configPayload struct {
+  Files []string `json:"files" yaml:"files" env:"FILES"`
+}
+
+type configWebUI struct {
+  Enabled        *bool  `json:"enabled" yaml:"enabled" env:"WEBUI"`
+  DirectoryURL   string `json:"directoryUrl" yaml:"directoryUrl" env:"WEBUI_DIRECTORY_URL"`
+  DefaultSeconds int    `json:"defaultSeconds" yaml:"defaultSeconds" env:"WEBUI_DEFAULT_SECONDS"`
+  DefaultStreams int    `json:"defaultStreams" yaml:"defaultStreams" env:"WEBUI_DEFAULT_STREAMS"`
+}
+
+// configFile: isi file yang sedang dipakai, sudah dipetakan ke nama env.
+type configFile struct {
+  path    string
+  modTime time.Time
+  values  map[string]string // env -> nilai
+}
+
+var (
+  fileConfig  atomic.Pointer[configFile]
+  configPaths = map[string]string{} // env -> path di file (limits.maxStreams), untuk log reload
+)
+
+// env yang diterapkan ulang saat reload; lainnya baru berlaku setelah restart.
+var configReloadable = []string{
+  "MAX_STREAMS", "MAX_NODE_STREAMS", "MAX_DURATION_SEC", "MAX_STREAM_MB", "RETRY_AFTER_SEC",
+  "UDP_MAX_PPS", "CORS_ORIGINS", "TRUSTED_PROXIES",
+  "WEBUI_DIRECTORY_URL", "WEBUI_DEFAULT_SECONDS", "WEBUI_DEFAULT_STREAMS",
+}
+
+// fileValue: nilai dari CONFIG_FILE untuk env k (kosong kalau tidak ada).
+func fileValue(k string) string {
+  if c := fileConfig.Load(); c != nil { return c.values[k] }
+  return ""
+}
+
+func readConfigFile(path string) (*configFile, error) {
+  st, err := os.Stat(path)
+  if err != nil { return nil, err }
+  b, err := os.ReadFile(path)
+  if err != nil { return nil, err }
+  var c nodeConfig
+  if strings.EqualFold(filepath.Ext(path), ".json") {
+    dec := json.NewDecoder(bytes.NewReader(b))
+    dec.DisallowUnknownFields()
+    err = dec.Decode(&c)
+  } else {
+    dec := yaml.NewDecoder(bytes.NewReader(b))
+    dec.KnownFields(true)
+    if err = dec.Decode(&c); errors.Is(err, io.EOF) { err = nil } // file kosong
+  }
+  if err != nil { return nil, fmt.Errorf("config %s: %w", path, err) }
+  eff := c
+  envErrs := applyEnv(reflect.ValueOf(&eff).Elem(), "")
+  if err := errors.Join(append(envErrs, eff.validate())...); err != nil { return nil, fmt.Errorf("config %s:\n%w", path, err) }
+  return &configFile{path: path, modTime: st.ModTime(), values: flattenConfig(reflect.ValueOf(c), "")}, nil
+}
+
+// flattenConfig: field yang diisi -> map env; list digabung koma, bool jadi "1"/"0".
+func flattenConfig(v reflect.Value, prefix string) map[string]string {
+  out := map[string]string{}
+  t := v.Type()
+  for i := range t.NumField() {
+    f, fv := t.Field(i), v.Field(i)
+    path := prefix + strings.Split(f.Tag.Get("yaml"), ",")[0]
+    if f.Type.Kind() == reflect.Struct {
+      for k, s := range flattenConfig(fv, path+".") { out[k] = s }
+      continue
+    }
+    env := f.Tag.Get("env")
+    configPaths[env] = path
+    switch x := fv.Interface().(type) {
+    case string:
+      if x != "" { out[env] = x }
+    case int:
+      if x != 0 { out[env] = strconv.Itoa(x) }
+    case *bool:
+      if x != nil { out[env] = map[bool]string{true: "1", false: "0"}[*x] }
+    case []string:
+      if x != nil { out[env] = strings.Join(x, ",") }
+    }
+  }
+  return out
+}
+
+// applyEnv menimpa field v dengan env yang di-set (nilai yang akhirnya dibaca getenv), supaya
+// validate memeriksa konfigurasi efektif. Bool tidak divalidasi, jadi dilewati.
+func applyEnv(v reflect.Value, prefix string) (errs []error) {
+  t := v.Type()
+  for i := range t.NumField() {
+    f, fv := t.Field(i), v.Field(i)
+    path := prefix + strings.Split(f.Tag.Get("yaml"), ",")[0]
+    if f.Type.Kind() == reflect.Struct {
+      errs = append(errs, applyEnv(fv, path+".")...)
+      continue
+    }
+    env := f.Tag.Get("env")
+    s := os.Getenv(env)
+    if s == "" { continue }
+    switch fv.Interface().(type) {
+    case string:
+      fv.SetString(s)
+    case int:
+      n, err := strconv.Atoi(s)
+      if err != nil { errs = append(errs, fmt.Errorf("  %s: %s=%q is not an integer", path, env, s)); continue }
+      fv.SetInt(int64(n))
+    case []string:
+      fv.Set(reflect.ValueOf(splitList(s)))
+    }
+  }
+  return errs
+}
+
+// splitList: "a, b,,c" -> [a b c], sama seperti loader env (CORS_ORIGINS, TCP_CC_ALLOWED, ...).
+func splitList(s string) []string {
+  var out []string
+  for _, e := range strings.Split(s, ",") {
+    if e = strings.TrimSpace(e); e != "" { out = append(out, e) }
+  }
+  return out
+}
+
+// validate: semua kesalahan sekaligus, satu baris per field.
+func (c *nodeConfig) validate() error {
+  var errs []error
+  bad := func(path, format string, a ...any) { errs = append(errs, fmt.Errorf("  %s: "+format, append([]any{path}, a...)...)) }
+  type intField struct {
+    path string
+    v    int
+  }
+  type strField struct {
+    path string
+    v    string
+  }
+
+  for _, f := range []intField{
+    {"node.heartbeatSec", c.Node.HeartbeatSec}, {"tls.reloadSec", c.TLS.ReloadSec},
+    {"limits.maxStreams", c.Limits.MaxStreams}, {"limits.maxNodeStreams", c.Limits.MaxNodeStreams},
+    {"limits.maxDurationSec", c.Limits.MaxDurationSec}, {"limits.maxStreamMb", c.Limits.MaxStreamMB},
+    {"limits.retryAfterSec", c.Limits.RetryAfterSec}, {"limits.maxSessions", c.Limits.MaxSessions},
+    {"limits.maxSessionsPerClient", c.Limits.MaxSessionsIP},
+    {"limits.sessionTtlSec", c.Limits.SessionTTLSec}, {"limits.drainTimeoutSec", c.Limits.DrainTimeoutSec},
+    {"limits.linkCapacityMbps", c.Limits.LinkCapacityMbps}, {"limits.udpMaxPps", c.Limits.UDPMaxPPS},
+    {"quota.egressBudgetHourGb", c.Quota.HourGB}, {"quota.egressBudgetDayGb", c.Quota.DayGB},
+    {"quota.egressBudgetMonthGb", c.Quota.MonthGB}, {"quota.clientDailyMb", c.Quota.ClientDailyMB},
+    {"quota.flushSec", c.Quota.FlushSec}, {"webui.defaultSeconds", c.WebUI.DefaultSeconds},
+    {"webui.defaultStreams", c.WebUI.DefaultStreams},
+  } {
+    if f.v < 0 { bad(f.path, "must be >= 0 (0 or omitted = default)") }
+  }
+  if l := c.Limits; l.MaxStreams > 0 && l.MaxNodeStreams > 0 && l.MaxStreams > l.MaxNodeStreams {
+    bad("limits.maxStreams", "must be <= limits.maxNodeStreams (%d)", l.MaxNodeStreams)
+  }
+
+  for _, f := range []strField{{"listen.http", c.Listen.HTTP}, {"listen.https", c.Listen.HTTPS}, {"listen.http3", c.Listen.HTTP3},
+    {"listen.udp", c.Listen.UDP}, {"listen.rawTcp", c.Listen.RawTCP}, {"listen.iperf3", c.Listen.Iperf3}} {
+    if f.v == "" { continue }
+    if _, port, err := net.SplitHostPort(f.v); err != nil {
+      bad(f.path, "%q is not host:port (e.g. \":8080\")", f.v)
+    } else if n, err := strconv.Atoi(port); err != nil || n < 0 || n > 65535 {
+      bad(f.path, "invalid port %q", port)
+    }
+  }
+  if (c.TLS.Cert == "") != (c.TLS.Key == "") { bad("tls", "cert and key must be set together") }
+  for _, f := range []strField{{"tls.cert", c.TLS.Cert}, {"tls.key", c.TLS.Key}, {"node.geoipDb", c.Node.GeoIPDB}, {"node.asnDb", c.Node.ASNDB}} {
+    if f.v == "" { continue }
+    if _, err := os.Stat(f.v); err != nil { bad(f.path, "%v", err) }
+  }
+  if c.Listen.HTTP3 != "" && c.TLS.Cert == "" { bad("listen.http3", "needs tls.cert and tls.key") }
+
+  for _, f := range []strField{{"node.publicUrl", c.Node.PublicURL}, {"node.directoryUrl", c.Node.DirectoryURL}, {"webui.directoryUrl", c.WebUI.DirectoryURL}} {
+    if f.v == "" { continue }
+    if u, err := url.Parse(f.v); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+      bad(f.path, "%q must be an http(s):// URL", f.v)
+    }
+  }
+  for _, o := range c.CORS.Origins {
+    if err := checkCORSOrigin(o); err != nil { bad("cors.origins", "%v", err) }
+  }
+  if _, err := parseTrustedProxies(strings.Join(c.Node.TrustedProxies, ",")); err != nil { bad("node.trustedProxies", "%v", err) }
+  if c.Payload.Files != nil {
+    if _, err := parseFiles(strings.Join(c.Payload.Files, ",")); err != nil { bad("payload.files", "%v", err) }
+  }
+  for _, a := range c.Protocols.CongestionControl {
+    if strings.TrimSpace(a) == "" || strings.ContainsAny(a, ", ") { bad("protocols.congestionControl", "invalid algorithm %q", a) }
+  }
+  return errors.Join(errs...)
+}
+
+// loadConfigFile: dipanggil paling awal di main, sebelum getenv pertama.
+func loadConfigFile(path string) error {
+  if path == "" { return nil }
+  c, err := readConfigFile(path)
+  if err != nil { return err }
+  fileConfig.Store(c)
+  var over []string
+  for k := range c.values {
+    if os.Getenv(k) != "" { over = append(over, k) }
+  }
+  slices.Sort(over)
+  log.Printf("config: %s (%d setting(s))", path, len(c.values))
+  if len(over) > 0 { log.Printf("config: overridden by environment: %s", strings.Join(over, ", ")) }
+  return nil
+}
+
+// watchConfig: reload saat SIGHUP, atau saat mtime file berubah (every <= 0 = hanya SIGHUP).
+func watchConfig(every time.Duration) {
+  c := fileConfig.Load()
+  if c == nil { return }
+  hup := make(chan os.Signal, 1)
+  signal.Notify(hup, syscall.SIGHUP)
+  var tickC <-chan time.Time // nil: case di bawah tidak pernah terpilih
+  if every > 0 {
+    tick := time.NewTicker(every)
+    defer tick.Stop()
+    tickC = tick.C
+  }
+  seen := c.modTime // file gagal divalidasi tidak dicoba ulang sampai berubah lagi
+  for {
+    select {
+    case <-hup:
+      reloadConfig(c.path)
+    case <-tickC:
+      st, err := os.Stat(c.path)
+      if err != nil || st.ModTime().Equal(seen) { continue }
+      seen = st.ModTime()
+      reloadConfig(c.path)
+    }
+  }
+}
+
+func reloadConfig(path string) {
+  next, err := readConfigFile(path)
+  if err != nil { log.Printf("config reload failed, keeping previous config: %v", err); return }
+  before := loadLimits() // limits efektif dari file lama (+ env)
+  prev := fileConfig.Swap(next)
+
+  var applied, restart []string
+  keys := make([]string, 0, len(configPaths))
+  for k := range configPaths { keys = append(keys, k) }
+  slices.Sort(keys)
+  for _, k := range keys {
+    if prev.values[k] == next.values[k] || os.Getenv(k) != "" { continue } // env tetap menang
+    if !slices.Contains(configReloadable, k) { restart = append(restart, configPaths[k]); continue }
+    applied = append(applied, configPaths[k])
+  }
+  if len(applied) == 0 && len(restart) == 0 { log.Printf("config reloaded from %s: no changes", path); return }
+
+  reloadLimits(before)
+  loadCORSOrigins(getenv("CORS_ORIGINS", ""))
+  if nets, err := parseTrustedProxies(getenv("TRUSTED_PROXIES", "")); err == nil { trustedProxies.Store(&nets) }
+
+  if len(applied) > 0 { log.Printf("config reloaded from %s: applied %s", path, strings.Join(applied, ", ")) }
+  if len(restart) > 0 { log.Printf("config: %s changed, restart required to apply", strings.Join(restart, ", ")) }
+}
+
+// reloadLimits: limits hanya diganti kalau nilai efektifnya berubah, supaya reload yang tidak
+// menyentuh limits tidak membuang perubahan lewat admin API (PUT /api/v1/admin/limits).
+func reloadLimits(before *limitsConfig) {
+  after := loadLimits()
+  if *after == *before { return }
+  limitsMu.Lock()
+  defer limitsMu.Unlock()
+  if cur := limits.Load(); *cur != *before {
+    log.Printf("config: limits changed in file, replacing limits set via admin API (%+v -> %+v)", *cur, *after)
+  }
+  limits.Store(after)
+}
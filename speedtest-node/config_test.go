@@ -0,0 +1,147 @@
+package main
+
+import (
+  "bytes"
+  "log"
+  "os"
+  "path/filepath"
+  "strings"
+  "testing"
+)
+
+func TestConfigValidate(t *testing.T) {
+  cert := filepath.Join(t.TempDir(), "cert.pem")
+  if err := os.WriteFile(cert, []byte("x"), 0o600); err != nil { t.Fatal(err) }
+
+  tests := []struct {
+    name string
+    c    nodeConfig
+    want []string // potongan pesan; kosong = valid
+  }{
+    {"empty", nodeConfig{}, nil},
+    {"full", nodeConfig{
+      Node:   configNode{PublicURL: "https://n.example.com", TrustedProxies: []string{"10.0.0.0/8"}},
+      Listen: configListen{HTTP: ":8080", HTTPS: "0.0.0.0:8443", HTTP3: ":8443"},
+      TLS:    configTLS{Cert: cert, Key: cert},
+      Limits: configLimits{MaxStreams: 8, MaxNodeStreams: 64},
+      CORS:   configCORS{Origins: []string{"https://speedtest.example.com"}},
+    }, nil},
+    {"zero means default", nodeConfig{Limits: configLimits{MaxStreams: 0, UDPMaxPPS: 0}}, nil},
+    {"negative", nodeConfig{Limits: configLimits{MaxStreams: -1}, Quota: configQuota{FlushSec: -5}},
+      []string{"limits.maxStreams: must be >= 0", "quota.flushSec: must be >= 0"}},
+    {"streams over node", nodeConfig{Limits: configLimits{MaxStreams: 10, MaxNodeStreams: 5}}, []string{"must be <= limits.maxNodeStreams (5)"}},
+    {"bad listen", nodeConfig{Listen: configListen{HTTP: "8080", UDP: ":99999"}}, []string{`listen.http: "8080" is not host:port`, `listen.udp: invalid port "99999"`}},
+    {"cert without key", nodeConfig{TLS: configTLS{Cert: cert}}, []string{"tls: cert and key must be set together"}},
+    {"missing cert file", nodeConfig{TLS: configTLS{Cert: "/nonexistent.pem", Key: cert}}, []string{"tls.cert:"}},
+    {"http3 without tls", nodeConfig{Listen: configListen{HTTP3: ":8443"}}, []string{"listen.http3: needs tls.cert"}},
+    {"bad urls", nodeConfig{Node: configNode{PublicURL: "ftp://x", DirectoryURL: "dir.example.com"}},
+      []string{"node.publicUrl", "node.directoryUrl"}},
+    {"bad cors", nodeConfig{CORS: configCORS{Origins: []string{"https://a.example.com/path"}}}, []string{"cors.origins"}},
+    {"bad proxies", nodeConfig{Node: configNode{TrustedProxies: []string{"not-a-cidr"}}}, []string{"node.trustedProxies"}},
+    {"bad files", nodeConfig{Payload: configPayload{Files: []string{"1XB"}}}, []string{"payload.files"}},
+    {"bad cc", nodeConfig{Protocols: configProtocols{CongestionControl: []string{"bbr,cubic"}}}, []string{"protocols.congestionControl"}},
+  }
+  for _, tt := range tests {
+    t.Run(tt.name, func(t *testing.T) {
+      err := tt.c.validate()
+      if len(tt.want) == 0 {
+        if err != nil { t.Fatalf("unexpected error: %v", err) }
+        return
+      }
+      if err == nil { t.Fatalf("no error, want %q", tt.want) }
+      for _, w := range tt.want {
+        if !strings.Contains(err.Error(), w) { t.Errorf("error %q does not contain %q", err, w) }
+      }
+      if n := strings.Count(err.Error(), "\n") + 1; n != len(tt.want) { t.Errorf("%d error line(s), want %d:\n%v", n, len(tt.want), err) }
+    })
+  }
+}
+
+func writeConfig(t *testing.T, body string) string {
+  t.Helper()
+  p := filepath.Join(t.TempDir(), "node.yaml")
+  if err := os.WriteFile(p, []byte(body), 0o600); err != nil { t.Fatal(err) }
+  return p
+}
+
+func TestReadConfigFileEffective(t *testing.T) {
+  cert := filepath.Join(t.TempDir(), "cert.pem")
+  if err := os.WriteFile(cert, []byte("x"), 0o600); err != nil { t.Fatal(err) }
+  p := writeConfig(t, "listen:\n  http3: \":8443\"\nlimits:\n  maxStreams: 8\n")
+
+  // TLS hanya dari env: gabungannya valid
+  if _, err := readConfigFile(p); err == nil || !strings.Contains(err.Error(), "listen.http3") {
+    t.Fatalf("without TLS env: err = %v, want listen.http3 error", err)
+  }
+  t.Setenv("TLS_CERT", cert)
+  t.Setenv("TLS_KEY", cert)
+  c, err := readConfigFile(p)
+  if err != nil { t.Fatalf("with TLS env: %v", err) }
+  if c.values["H3_ADDR"] != ":8443" || c.values["TLS_CERT"] != "" { t.Errorf("file values = %v, want only the file's own settings", c.values) }
+
+  // env yang tidak valid ikut dilaporkan
+  t.Setenv("MAX_STREAMS", "lots")
+  t.Setenv("MAX_NODE_STREAMS", "4")
+  _, err = readConfigFile(p)
+  if err == nil || !strings.Contains(err.Error(), `MAX_STREAMS="lots" is not an integer`) { t.Errorf("bad env int: err = %v", err) }
+  t.Setenv("MAX_STREAMS", "")
+  if _, err = readConfigFile(p); err == nil || !strings.Contains(err.Error(), "limits.maxNodeStreams (4)") {
+    t.Errorf("file maxStreams over env maxNodeStreams: err = %v", err)
+  }
+}
+
+// list env dengan spasi (sudah jalan tanpa CONFIG_FILE) tidak boleh membuat file ditolak
+func TestReadConfigFileSpacedEnvLists(t *testing.T) {
+  p := writeConfig(t, "cors:\n  origins: [https://a.example.com]\nprotocols:\n  congestionControl: [cubic]\n")
+  t.Setenv("CORS_ORIGINS", "https://a.example.com, https://b.example.com/ ,")
+  t.Setenv("TCP_CC_ALLOWED", "cubic, bbr")
+  t.Setenv("TRUSTED_PROXIES", "10.0.0.0/8, 192.168.0.0/16")
+  t.Setenv("FILES", "1MB, 10MB")
+  if _, err := readConfigFile(p); err != nil { t.Fatalf("spaced env lists: %v", err) }
+
+  t.Setenv("TCP_CC_ALLOWED", "cubic, b b r")
+  if _, err := readConfigFile(p); err == nil || !strings.Contains(err.Error(), `invalid algorithm "b b r"`) {
+    t.Errorf("bad algorithm still reported: err = %v", err)
+  }
+}
+
+func TestSplitList(t *testing.T) {
+  if got := splitList(" a, b ,,c ,"); strings.Join(got, "|") != "a|b|c" { t.Errorf("splitList = %q", got) }
+  if got := splitList(" , "); got != nil { t.Errorf("splitList of blanks = %q, want nil", got) }
+}
+
+func TestReadConfigFileUnknownField(t *testing.T) {
+  if _, err := readConfigFile(writeConfig(t, "limits:\n  maxStream: 8\n")); err == nil || !strings.Contains(err.Error(), "maxStream") {
+    t.Errorf("unknown yaml field: err = %v", err)
+  }
+  if _, err := readConfigFile(writeConfig(t, "")); err != nil { t.Errorf("empty file: %v", err) }
+}
+
+func TestReloadKeepsAdminLimits(t *testing.T) {
+  p := writeConfig(t, "limits:\n  maxStreams: 8\n")
+  c, err := readConfigFile(p)
+  if err != nil { t.Fatal(err) }
+  oldCfg, oldLimits := fileConfig.Load(), limits.Load()
+  t.Cleanup(func() { fileConfig.Store(oldCfg); limits.Store(oldLimits); loadCORSOrigins("") })
+  var logs bytes.Buffer
+  log.SetOutput(&logs)
+  t.Cleanup(func() { log.SetOutput(os.Stderr) })
+
+  fileConfig.Store(c)
+  limits.Store(loadLimits())
+  admin := *limits.Load()
+  admin.MaxStreams = 3 // PUT /api/v1/admin/limits
+  limits.Store(&admin)
+
+  // reload tanpa perubahan limits: nilai admin tetap
+  if err := os.WriteFile(p, []byte("limits:\n  maxStreams: 8\ncors:\n  origins: [https://a.example.com]\n"), 0o600); err != nil { t.Fatal(err) }
+  reloadConfig(p)
+  if got := limits.Load().MaxStreams; got != 3 { t.Fatalf("unrelated reload: maxStreams = %d, want admin value 3", got) }
+  if strings.Contains(logs.String(), "admin API") { t.Errorf("unexpected warning: %s", logs.String()) }
+
+  // limits di file berubah: dipakai, dengan peringatan
+  if err := os.WriteFile(p, []byte("limits:\n  maxStreams: 5\n"), 0o600); err != nil { t.Fatal(err) }
+  reloadConfig(p)
+  if got := limits.Load().MaxStreams; got != 5 { t.Errorf("limits reload: maxStreams = %d, want 5", got) }
+  if !strings.Contains(logs.String(), "replacing limits set via admin API") { t.Errorf("no warning logged: %s", logs.String()) }
+}
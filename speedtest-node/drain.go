@@ -0,0 +1,91 @@
+package main
+
+import (
+  "context"
+  "log"
+  "net/http"
+  "os"
+  "strconv"
+  "sync/atomic"
+  "time"
+)
+
+// Drain: SIGTERM/SIGINT tidak langsung mematikan node. Tes baru ditolak (503),
+// /healthz menjawab "draining" supaya directory mengeluarkan node dari rotasi,
+// tes yang sedang jalan dibiarkan selesai sampai DRAIN_TIMEOUT_SEC, baru Shutdown.
+// Sinyal kedua memotong masa tunggu.
+
+var (
+  draining    atomic.Bool
+  maintenance atomic.Bool // dari admin API; seperti drain tapi tanpa shutdown
+)
+
+// refusingTests: tes baru ditolak selama drain atau maintenance.
+func refusingTests() bool { return draining.Load() || maintenance.Load() }
+
+func nodeState() string {
+  switch {
+  case draining.Load():
+    return "draining"
+  case maintenance.Load():
+    return "maintenance"
+  }
+  return "up"
+}
+
+// rejectDraining: 503 untuk tes baru selama drain/maintenance (klien sebaiknya pindah node).
+func rejectDraining(w http.ResponseWriter) {
+  state := nodeState()
+  metrics.reject(state)
+  w.Header().Set("Retry-After", strconv.Itoa(limits.Load().RetryAfterSec))
+  msg := "node is draining"
+  if state == "maintenance" { msg = "node is in maintenance" }
+  http.Error(w, msg, http.StatusServiceUnavailable)
+}
+
+// shutdownc menerima SIGTERM/SIGINT, juga permintaan drain dari admin API.
+var shutdownc = make(chan os.Signal, 2)
+
+type shutdowner interface {
+  Shutdown(ctx context.Context) error
+}
+
+// sesi yang baru dipakai dianggap masih di tengah tes (mis. jeda antara download & upload)
+const drainSessionIdle = 5 * time.Second
+
+func drainAndShutdown(sig <-chan os.Signal, timeout time.Duration, servers []shutdowner) {
+  draining.Store(true)
+  if dirRegistrar != nil { dirRegistrar.heartbeat() } // kabari directory sekarang, jangan tunggu tick
+  log.Printf("draining: refusing new tests, waiting up to %s for %d stream(s)", timeout, admit.active())
+
+  deadline := time.Now().Add(timeout)
+  tick := time.NewTicker(500 * time.Millisecond)
+  defer tick.Stop()
+wait:
+  for {
+    streams, busy := admit.active(), sessions.activeWithin(drainSessionIdle)
+    switch {
+    case streams == 0 && busy == 0:
+      log.Printf("draining: all tests finished")
+      break wait
+    case time.Now().After(deadline):
+      log.Printf("draining: timeout, %d stream(s) and %d session(s) still active", streams, busy)
+      break wait
+    }
+    select {
+    case s := <-sig:
+      log.Printf("%s received again, shutting down now", s)
+      break wait
+    case <-tick.C:
+    }
+  }
+
+  ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+  defer cancel()
+  for _, s := range servers {
+    if err := s.Shutdown(ctx); err != nil { log.Printf("shutdown: %v", err) }
+  }
+  if udpSvc != nil { _ = udpSvc.conn.Close() }
+  quota.save()
+  log.Printf("shutdown complete")
+}
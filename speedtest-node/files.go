@@ -0,0 +1,203 @@
+package main
+
+import (
+  "encoding/json"
+  "errors"
+  "fmt"
+  "io"
+  "log"
+  "net/http"
+  "sort"
+  "strconv"
+  "strings"
+  "time"
+)
+
+// /files/{name}: file virtual berukuran tetap (mis. /files/100MB.bin) untuk curl/wget/tes
+// download di firmware router. Isinya dibuat saat dikirim (tidak ada di disk) tapi
+// deterministik per offset, jadi Range, HEAD, ETag/If-Range (resume) bekerja lewat
+// http.ServeContent. Katalog dari FILES (default "1MB,10MB,100MB,1GB", satuan biner).
+
+const fileSeed = 0x4a494e4f4d // sama di semua node dan tiap restart, ETag tetap valid
+
+const fileBlockSize = 64 << 10
+
+// fileBlock mengisi b dengan blok ke-idx. Tiap blok punya xoshiro sendiri yang di-seed dari
+// index-nya, jadi isi file tidak berulang (tidak bisa dikompres/di-dedup) tapi byte di offset
+// yang sama selalu sama.
+func fileBlock(idx int64, b []byte) { newRandomPayload(fileSeed + uint64(idx)).fill(b) }
+
+var files = map[string]int64{} // nama -> ukuran byte
+
+// parseSize: "100MB", "512K", "1G", "1500" (byte). K/M/G = 1024^n.
+func parseSize(s string) (int64, error) {
+  u := strings.TrimSuffix(strings.ToUpper(strings.TrimSpace(s)), "B")
+  mul := int64(1)
+  switch {
+  case strings.HasSuffix(u, "K"): mul = 1 << 10
+  case strings.HasSuffix(u, "M"): mul = 1 << 20
+  case strings.HasSuffix(u, "G"): mul = 1 << 30
+  }
+  if mul > 1 { u = u[:len(u)-1] }
+  n, err := strconv.ParseInt(u, 10, 64)
+  if err != nil || n <= 0 || n > (1<<40)/mul { return 0, fmt.Errorf("invalid file size %q", s) }
+  return n * mul, nil
+}
+
+// parseFiles: FILES="1MB,10MB,100MB,1GB" -> 1MB.bin, 10MB.bin, ...; "nama=ukuran" untuk nama sendiri.
+func parseFiles(spec string) (map[string]int64, error) {
+  out := map[string]int64{}
+  for _, e := range strings.Split(spec, ",") {
+    e = strings.TrimSpace(e)
+    if e == "" { continue }
+    name, size, ok := strings.Cut(e, "=")
+    if !ok { name, size = e+".bin", e }
+    if strings.ContainsAny(name, "/\\") || strings.HasPrefix(name, ".") { return nil, fmt.Errorf("invalid file name %q", name) }
+    n, err := parseSize(size)
+    if err != nil { return nil, err }
+    out[name] = n
+  }
+  if len(out) == 0 { return nil, errors.New("FILES is empty") }
+  return out, nil
+}
+
+func loadFiles(spec string) (err error) {
+  files, err = parseFiles(spec)
+  return err
+}
+
+func fileNames() []string {
+  names := make([]string, 0, len(files))
+  for n := range files { names = append(names, n) }
+  sort.Slice(names, func(i, j int) bool { return files[names[i]] < files[names[j]] })
+  return names
+}
+
+// virtualFile: io.ReadSeeker di atas fileBlock, byte ke-i selalu sama. Blok terakhir
+// disimpan karena ServeContent membaca per 32 KiB.
+type virtualFile struct {
+  size, off int64
+  blk       int64 // index blok di buf
+  buf       []byte
+}
+
+func (f *virtualFile) Read(p []byte) (int, error) {
+  if f.off >= f.size { return 0, io.EOF }
+  p = p[:min(int64(len(p)), f.size-f.off)]
+  if f.buf == nil { f.buf, f.blk = make([]byte, fileBlockSize), -1 }
+  n := 0
+  for n < len(p) {
+    pos := f.off + int64(n)
+    if idx := pos / fileBlockSize; idx != f.blk { fileBlock(idx, f.buf); f.blk = idx }
+    n += copy(p[n:], f.buf[pos%fileBlockSize:])
+  }
+  f.off += int64(n)
+  return n, nil
+}
+
+func (f *virtualFile) Seek(off int64, whence int) (int64, error) {
+  switch whence {
+  case io.SeekCurrent: off += f.off
+  case io.SeekEnd: off += f.size
+  }
+  if off < 0 { return 0, errors.New("negative seek") }
+  f.off = off
+  return off, nil
+}
+
+// fileWriter: hitung byte keluar (metrics, kuota egress, impairment).
+type fileWriter struct {
+  http.ResponseWriter
+  r  *http.Request
+  ip string
+  im *impairment
+}
+
+func (fw *fileWriter) Write(p []byte) (int, error) {
+  allowed := quota.add(fw.ip, len(p))
+  n, err := fw.ResponseWriter.Write(p[:allowed])
+  metrics.bytesSent.Add(int64(n))
+  // sisa kuota sudah dicek di apiFile; ini hanya kalau stream lain menghabiskannya duluan
+  if allowed < len(p) { panic(http.ErrAbortHandler) }
+  if fw.im.step(n) != nil { impairAbort(fw.r) }
+  return n, err
+}
+
+// rangeLength: byte body yang akan dikirim ServeContent untuk header Range. Kalau Range
+// tidak ada, tidak valid atau ada If-Range, anggap seluruh file (perkiraan aman).
+func rangeLength(r *http.Request, size int64) int64 {
+  spec, ok := strings.CutPrefix(r.Header.Get("Range"), "bytes=")
+  if !ok || r.Header.Get("If-Range") != "" { return size }
+  var total int64
+  for _, ra := range strings.Split(spec, ",") {
+    first, last, ok := strings.Cut(strings.TrimSpace(ra), "-")
+    if !ok { return size }
+    if first == "" { // bytes=-N: N byte terakhir
+      n, err := strconv.ParseInt(last, 10, 64)
+      if err != nil || n < 0 { return size }
+      total += min(n, size)
+      continue
+    }
+    start, err := strconv.ParseInt(first, 10, 64)
+    if err != nil || start < 0 || start >= size { return size }
+    end := size - 1
+    if last != "" {
+      if end, err = strconv.ParseInt(last, 10, 64); err != nil || end < start { return size }
+      end = min(end, size-1)
+    }
+    total += end - start + 1
+  }
+  return min(total, size)
+}
+
+// apiFiles: GET /files/ -> katalog.
+func apiFiles(w http.ResponseWriter, r *http.Request) {
+  list := []map[string]any{}
+  for _, n := range fileNames() {
+    list = append(list, map[string]any{"name": n, "size": files[n], "url": "/files/" + n})
+  }
+  w.Header().Set("Content-Type", "application/json")
+  _ = json.NewEncoder(w).Encode(list)
+}
+
+func apiFile(w http.ResponseWriter, r *http.Request) {
+  name := r.PathValue("name")
+  size, ok := files[name]
+  if !ok { http.NotFound(w, r); return }
+  if r.Method != http.MethodGet && r.Method != http.MethodHead {
+    http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+    return
+  }
+  im, err := requestImpairment(r.URL.Query(), nil)
+  if err != nil { http.Error(w, err.Error(), http.StatusBadRequest); return }
+
+  w.Header().Set("Content-Type", "application/octet-stream") // tanpa sniffing
+  w.Header().Set("Cache-Control", "no-store, no-transform")
+  w.Header().Set("ETag", fmt.Sprintf(`"%x-%x-%x"`, size, fileSeed, fileBlockSize))
+  if im != nil { w.Header().Set("X-Impairment", im.name) }
+  f := &virtualFile{size: size}
+  if r.Method == http.MethodHead { // HEAD tidak makan slot stream
+    http.ServeContent(w, r, name, time.Time{}, f)
+    return
+  }
+
+  // GET: sama seperti /api/v1/download (drain, slot stream, kuota), tapi tanpa clamp
+  // waktu/byte karena Content-Length sudah dijanjikan.
+  if refusingTests() { rejectDraining(w); return }
+  ip := clientIP(r)
+  if !admit.acquire(ip) { rejectBusy(w); return }
+  defer admit.release(ip)
+  if !quota.admitFile(w, ip, rangeLength(r, size)) { return }
+  metrics.activeDown.Add(1)
+  defer metrics.activeDown.Add(-1)
+  im.wait()
+  http.ServeContent(&fileWriter{ResponseWriter: w, r: r, ip: ip, im: im}, r, name, time.Time{}, f)
+}
+
+func registerFiles(mux *http.ServeMux, spec string) {
+  if err := loadFiles(spec); err != nil { log.Fatal(err) }
+  mux.HandleFunc("/files/{$}", withCORS(apiFiles))
+  mux.HandleFunc("/files/{name}", withCORS(apiFile))
+  addCapability("files")
+  log.Printf("serving virtual files: %s", strings.Join(fileNames(), ", "))
+}
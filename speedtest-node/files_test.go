@@ -0,0 +1,101 @@
+package main
+
+import (
+  "bytes"
+  "compress/flate"
+  "io"
+  "net/http/httptest"
+  "testing"
+)
+
+func TestParseSize(t *testing.T) {
+  tests := []struct {
+    in   string
+    want int64
+  }{
+    {"1500", 1500}, {"512K", 512 << 10}, {"512kb", 512 << 10}, {"100MB", 100 << 20},
+    {" 1G ", 1 << 30}, {"3M", 3 << 20}, {"1024G", 1 << 40},
+  }
+  for _, tt := range tests {
+    got, err := parseSize(tt.in)
+    if err != nil || got != tt.want { t.Errorf("parseSize(%q) = %d, %v, want %d", tt.in, got, err, tt.want) }
+  }
+  for _, in := range []string{"", "MB", "0", "-1M", "1.5G", "1T", "1025G", "abc"} {
+    if _, err := parseSize(in); err == nil { t.Errorf("parseSize(%q) succeeded, want error", in) }
+  }
+}
+
+func TestParseFiles(t *testing.T) {
+  got, err := parseFiles(" 1MB, 10MB ,fw.img=3M,,")
+  if err != nil { t.Fatal(err) }
+  want := map[string]int64{"1MB.bin": 1 << 20, "10MB.bin": 10 << 20, "fw.img": 3 << 20}
+  if len(got) != len(want) { t.Fatalf("parseFiles = %v, want %v", got, want) }
+  for n, sz := range want {
+    if got[n] != sz { t.Errorf("%s = %d, want %d", n, got[n], sz) }
+  }
+  for _, spec := range []string{"", " , ", "../x=1M", "a/b=1M", ".hidden=1M", "x=big", "1XB"} {
+    if _, err := parseFiles(spec); err == nil { t.Errorf("parseFiles(%q) succeeded, want error", spec) }
+  }
+}
+
+func TestVirtualFileDeterministic(t *testing.T) {
+  const size = 3*fileBlockSize + 1234
+  whole, err := io.ReadAll(&virtualFile{size: size})
+  if err != nil || len(whole) != size { t.Fatalf("ReadAll = %d bytes, %v", len(whole), err) }
+
+  // baca ulang dengan ukuran buffer ganjil dan Seek: hasil harus sama per offset
+  f := &virtualFile{size: size}
+  for _, off := range []int64{fileBlockSize - 7, 5, 2*fileBlockSize + 100, size - 10} {
+    if _, err := f.Seek(off, io.SeekStart); err != nil { t.Fatal(err) }
+    buf := make([]byte, 1000)
+    n, _ := io.ReadFull(f, buf)
+    if !bytes.Equal(buf[:n], whole[off:off+int64(n)]) { t.Errorf("read at %d differs", off) }
+  }
+  if n, err := f.Read(make([]byte, 10)); n != 0 || err != io.EOF { t.Errorf("read at EOF = %d, %v", n, err) }
+  if pos, _ := f.Seek(-10, io.SeekEnd); pos != size-10 { t.Errorf("SeekEnd = %d", pos) }
+  if _, err := f.Seek(-1, io.SeekStart); err == nil { t.Error("negative seek succeeded") }
+}
+
+func TestVirtualFileNotRepeating(t *testing.T) {
+  data, _ := io.ReadAll(&virtualFile{size: 4 * fileBlockSize})
+  seen := map[string]bool{}
+  for i := 0; i < len(data); i += fileBlockSize {
+    k := string(data[i : i+64])
+    if seen[k] { t.Fatalf("block at %d repeats an earlier block", i) }
+    seen[k] = true
+  }
+  var z bytes.Buffer
+  zw, _ := flate.NewWriter(&z, flate.BestCompression)
+  zw.Write(data)
+  zw.Close()
+  if z.Len() < len(data) { t.Errorf("file compresses from %d to %d bytes", len(data), z.Len()) }
+}
+
+func TestRangeLength(t *testing.T) {
+  const size = 1000
+  tests := []struct {
+    rng, ifRange string
+    want         int64
+  }{
+    {"", "", size},
+    {"bytes=0-99", "", 100},
+    {"bytes=900-", "", 100},
+    {"bytes=-10", "", 10},
+    {"bytes=-5000", "", size},
+    {"bytes=990-5000", "", 10},
+    {"bytes=0-9, 20-29", "", 20},
+    {"bytes=0-999,0-999", "", size}, // ServeContent mengirim seluruh file
+    {"bytes=5000-", "", size},       // tidak terpenuhi: 416 dari ServeContent
+    {"bytes=x-1", "", size},
+    {"items=0-1", "", size},
+    {"bytes=0-99", `"etag"`, size},
+  }
+  for _, tt := range tests {
+    r := httptest.NewRequest("GET", "/files/x", nil)
+    if tt.rng != "" { r.Header.Set("Range", tt.rng) }
+    if tt.ifRange != "" { r.Header.Set("If-Range", tt.ifRange) }
+    if got := rangeLength(r, size); got != tt.want {
+      t.Errorf("rangeLength(%q, If-Range %q) = %d, want %d", tt.rng, tt.ifRange, got, tt.want)
+    }
+  }
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+  "net"
+  "net/http"
+  "strconv"
+
+  "github.com/quic-go/quic-go"
+  "github.com/quic-go/quic-go/http3"
+)
+
+// HTTP/3 (QUIC) di port UDP: handler yang sama dengan TCP, jadi /api/v1/latency,
+// /download dan /upload bisa dibandingkan TCP vs QUIC ke node yang sama.
+
+func newHTTP3Server(addr string, handler http.Handler, certs *certReloader) *http3.Server {
+  return &http3.Server{
+    Addr:      addr,
+    Handler:   handler,
+    TLSConfig: http3.ConfigureTLSConfig(certs.tlsConfig()),
+    QUICConfig: &quic.Config{
+      // window default terlalu kecil untuk upload multi-Gbps
+      MaxStreamReceiveWindow:     16 << 20,
+      MaxConnectionReceiveWindow: 64 << 20,
+    },
+  }
+}
+
+// withAltSvc mengiklankan HTTP/3 di respons TCP (browser pindah ke QUIC setelahnya).
+func withAltSvc(h3 *http3.Server, h http.Handler) http.Handler {
+  return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+    _ = h3.SetQUICHeaders(w.Header())
+    h.ServeHTTP(w, r)
+  })
+}
+
+func portOf(addr string) int {
+  _, p, err := net.SplitHostPort(addr)
+  if err != nil { return 0 }
+  n, _ := strconv.Atoi(p)
+  return n
+}
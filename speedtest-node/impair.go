@@ -0,0 +1,195 @@
+package main
+
+import (
+  "errors"
+  "fmt"
+  "math/rand/v2"
+  "net"
+  "net/http"
+  "net/url"
+  "sort"
+  "strconv"
+  "strings"
+  "sync"
+  "sync/atomic"
+  "time"
+)
+
+// Mode impairment untuk QA (IMPAIRMENT_ENABLED=1): delay/jitter, batas rate, stall
+// dan reset koneksi disuntikkan di dalam node ke stream download/upload dan respons
+// latency. Dipilih per request (?profile=3g) atau per sesi (POST /api/v1/sessions?profile=3g),
+// parameter profil bisa di-override (delayMs=, rateKbps=, ...). Dengan seed= urutan
+// jitter/stall/reset selalu sama, jadi keluhan lapangan bisa direproduksi.
+
+type impairProfile struct {
+  DelayMs   int     `json:"delayMs"`   // tambahan RTT
+  JitterMs  int     `json:"jitterMs"`  // +/- acak di atas delay
+  RateKbps  int     `json:"rateKbps"`  // 0 = tanpa batas
+  StallProb float64 `json:"stallProb"` // peluang stall per 64 KiB
+  StallMs   int     `json:"stallMs"`
+  ResetProb float64 `json:"resetProb"` // peluang koneksi diputus (RST) per 64 KiB
+}
+
+var impairProfiles = map[string]impairProfile{
+  "edge":       {DelayMs: 400, JitterMs: 100, RateKbps: 200, StallProb: 0.05, StallMs: 2000},
+  "3g":         {DelayMs: 150, JitterMs: 40, RateKbps: 1600, StallProb: 0.02, StallMs: 800},
+  "lte":        {DelayMs: 40, JitterMs: 10, RateKbps: 20000},
+  "satellite":  {DelayMs: 600, JitterMs: 20, RateKbps: 10000, StallProb: 0.002, StallMs: 1500},
+  "lossy-wifi": {DelayMs: 10, JitterMs: 30, RateKbps: 30000, StallProb: 0.003, StallMs: 300, ResetProb: 0.0005},
+}
+
+var impairEnabled bool
+
+const impairUnit = 64 << 10 // granularitas stall/reset (dan ukuran write saat impaired)
+
+var errImpairReset = errors.New("impairment: connection reset")
+
+// impairSpec: profil yang dipilih (per request atau disimpan di sesi).
+type impairSpec struct {
+  Name    string `json:"profile"`
+  impairProfile
+  Seed    uint64 `json:"seed,omitempty"`
+  seeded  bool
+  streams atomic.Uint64 // stream ke-n dalam sesi dapat seed+n
+}
+
+func impairNames() []string {
+  names := make([]string, 0, len(impairProfiles))
+  for n := range impairProfiles { names = append(names, n) }
+  sort.Strings(names)
+  return names
+}
+
+// parseImpairment: profile= (+ override per parameter) dan seed=. nil kalau tidak diminta.
+func parseImpairment(q url.Values) (*impairSpec, error) {
+  name := q.Get("profile")
+  custom := false
+  for _, k := range []string{"delayMs", "jitterMs", "rateKbps", "stallProb", "stallMs", "resetProb"} {
+    if q.Has(k) { custom = true }
+  }
+  if name == "" && !custom { return nil, nil }
+  if !impairEnabled { return nil, errors.New("impairment mode is disabled on this node") }
+
+  p, ok := impairProfiles[name]
+  if name == "" {
+    name = "custom"
+  } else if !ok {
+    return nil, fmt.Errorf("unknown profile %q (available: %s)", name, strings.Join(impairNames(), ", "))
+  }
+  ints := []struct {
+    k  string
+    v  *int
+    hi int
+  }{{"delayMs", &p.DelayMs, 10000}, {"jitterMs", &p.JitterMs, 10000}, {"rateKbps", &p.RateKbps, 10000000}, {"stallMs", &p.StallMs, 60000}}
+  for _, f := range ints {
+    if !q.Has(f.k) { continue }
+    n, err := strconv.Atoi(q.Get(f.k))
+    if err != nil || n < 0 || n > f.hi { return nil, fmt.Errorf("%s must be 0..%d", f.k, f.hi) }
+    *f.v = n
+  }
+  for _, f := range []struct {
+    k string
+    v *float64
+  }{{"stallProb", &p.StallProb}, {"resetProb", &p.ResetProb}} {
+    if !q.Has(f.k) { continue }
+    x, err := strconv.ParseFloat(q.Get(f.k), 64)
+    if err != nil || x < 0 || x > 1 { return nil, fmt.Errorf("%s must be 0..1", f.k) }
+    *f.v = x
+  }
+
+  spec := &impairSpec{Name: name, impairProfile: p}
+  if s := q.Get("seed"); s != "" {
+    n, err := strconv.ParseUint(s, 10, 64)
+    if err != nil { return nil, errors.New("seed must be an unsigned integer") }
+    spec.Seed, spec.seeded = n, true
+  }
+  return spec, nil
+}
+
+// requestImpairment: profil dari query, atau profil sesi kalau query kosong.
+func requestImpairment(q url.Values, ss *session) (*impairment, error) {
+  spec, err := parseImpairment(q)
+  if err != nil { return nil, err }
+  if spec == nil && ss != nil { spec = ss.impair }
+  return spec.stream(), nil
+}
+
+// impairment: state satu stream/koneksi. Semua method aman dipanggil pada nil.
+type impairment struct {
+  name  string
+  p     impairProfile
+  mu    sync.Mutex // rng dipakai beberapa goroutine di WS latency
+  rng   *rand.Rand
+  start time.Time
+  bytes int64
+  units int64
+}
+
+func (s *impairSpec) stream() *impairment {
+  if s == nil { return nil }
+  seed := rand.Uint64()
+  if s.seeded { seed = s.Seed + s.streams.Add(1) - 1 }
+  return &impairment{name: s.Name, p: s.impairProfile, rng: rand.New(rand.NewPCG(seed, seed^0x9e3779b97f4a7c15))}
+}
+
+// delay: tambahan RTT untuk satu respons (delay +/- jitter).
+func (im *impairment) delay() time.Duration {
+  if im == nil { return 0 }
+  im.mu.Lock()
+  defer im.mu.Unlock()
+  ms := float64(im.p.DelayMs)
+  if im.p.JitterMs > 0 { ms += (im.rng.Float64()*2 - 1) * float64(im.p.JitterMs) }
+  return time.Duration(max(ms, 0) * float64(time.Millisecond))
+}
+
+// wait: tahan respons sebesar delay(); pacing rate dihitung mulai setelahnya.
+func (im *impairment) wait() {
+  if im == nil { return }
+  time.Sleep(im.delay())
+  im.mu.Lock()
+  im.start = time.Now()
+  im.mu.Unlock()
+}
+
+// segment: ukuran write/read berikutnya (dipecah per 64 KiB saat impaired).
+func (im *impairment) segment(n int) int {
+  if im == nil { return n }
+  return min(n, impairUnit)
+}
+
+// step: catat n byte; bisa stall, tidur untuk pacing rate, atau minta koneksi diputus.
+func (im *impairment) step(n int) error {
+  if im == nil { return nil }
+  im.mu.Lock()
+  defer im.mu.Unlock()
+  if im.start.IsZero() { im.start = time.Now() }
+  im.bytes += int64(n)
+  for ; im.units < im.bytes/impairUnit; im.units++ {
+    if im.p.ResetProb > 0 && im.rng.Float64() < im.p.ResetProb { return errImpairReset }
+    if im.p.StallProb > 0 && im.rng.Float64() < im.p.StallProb {
+      d := time.Duration(im.p.StallMs) * time.Millisecond
+      time.Sleep(d)
+      im.start = im.start.Add(d) // jangan "kejar" byte yang tertunda stall
+    }
+  }
+  if im.p.RateKbps > 0 {
+    due := im.start.Add(time.Duration(float64(im.bytes*8) / float64(im.p.RateKbps) * float64(time.Millisecond)))
+    if d := time.Until(due); d > 0 { time.Sleep(d) }
+  }
+  return nil
+}
+
+// resetConn: tutup dengan RST (SO_LINGER=0), bukan FIN, seperti koneksi yang putus di jalan.
+func resetConn(c net.Conn) {
+  if tc := tcpConnOf(c); tc != nil { _ = tc.SetLinger(0) }
+  if c != nil { _ = c.Close() }
+}
+
+// impairAbort: putus request HTTP di tengah stream. Di HTTP/1 koneksinya di-RST,
+// di h2/h3 hanya stream-nya yang di-reset.
+func impairAbort(r *http.Request) {
+  if r.ProtoMajor == 1 {
+    if tc := requestTCPConn(r); tc != nil { _ = tc.SetLinger(0) }
+  }
+  panic(http.ErrAbortHandler)
+}
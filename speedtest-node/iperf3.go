@@ -0,0 +1,579 @@
+package main
+
+import (
+  "cmp"
+  "context"
+  "encoding/binary"
+  "encoding/json"
+  "errors"
+  "fmt"
+  "io"
+  "log"
+  "net"
+  "net/netip"
+  "slices"
+  "strings"
+  "sync"
+  "sync/atomic"
+  "time"
+)
+
+// Server protokol iperf3 (IPERF3_ADDR, mis. :5201) supaya `iperf3 -c node` langsung bisa
+// dipakai tanpa daemon iperf3 terpisah. Mendukung TCP dan UDP (-u), -R, --bidir, -P, -O, -t,
+// --get-server-output; hasil JSON dikirim balik seperti iperf3 asli. Beda dengan iperf3:
+// beberapa tes boleh jalan bersamaan, dan tiap tes ikut limit node (slot stream per client,
+// MAX_DURATION_SEC, drain, kuota egress) serta metrics byte/stream.
+//
+// Alur kontrol (satu byte state, JSON = panjang uint32 big-endian + isi):
+//   klien: cookie 37 byte  →  node: PARAM_EXCHANGE, klien: JSON parameter
+//   node: CREATE_STREAMS   →  klien membuka stream data (TCP: cookie; UDP: datagram connect)
+//   node: TEST_START, TEST_RUNNING  →  data jalan sampai klien kirim TEST_END
+//   node: EXCHANGE_RESULTS, baca hasil klien, kirim hasil node, DISPLAY_RESULTS  →  klien: IPERF_DONE
+// Ditolak (drain, slot penuh, kuota) = ACCESS_DENIED; melewati MAX_DURATION_SEC = SERVER_TERMINATE.
+
+const (
+  i3TestStart       = 1
+  i3TestRunning     = 2
+  i3TestEnd         = 4
+  i3ParamExchange   = 9
+  i3CreateStreams   = 10
+  i3ServerTerminate = 11
+  i3ClientTerminate = 12
+  i3ExchangeResults = 13
+  i3DisplayResults  = 14
+  i3IperfDone       = 16
+  i3AccessDenied    = -1
+
+  i3CookieSize = 37
+  i3MaxJSON    = 1 << 20
+)
+
+// datagram "connect" UDP (int native-endian di sisi klien; dijawab dengan urutan byte yang sama)
+var i3UDPConnect = [][2]uint32{{0x36373839, 0x39383736}, {123456789, 987654321}}
+
+type i3Params struct {
+  TCP              bool   `json:"tcp"`
+  UDP              bool   `json:"udp"`
+  Omit             int    `json:"omit"`
+  Time             int    `json:"time"`
+  Num              int64  `json:"num"`
+  Parallel         int    `json:"parallel"`
+  Reverse          bool   `json:"reverse"`
+  Bidirectional    bool   `json:"bidirectional"`
+  Window           int    `json:"window"`
+  Len              int    `json:"len"`
+  Bandwidth        uint64 `json:"bandwidth"` // bit/s
+  Congestion       string `json:"congestion"`
+  GetServerOutput  int    `json:"get_server_output"`
+  UDPCounters64    int    `json:"udp_counters_64bit"`
+  RepeatingPayload int    `json:"repeating_payload"`
+  ClientVersion    string `json:"client_version"`
+}
+
+type i3Stream struct {
+  seq    uint64 // urutan accept, stream diurutkan seperti klien membukanya
+  id     int
+  sender bool // node yang mengirim
+  conn   net.Conn       // TCP
+  addr   netip.AddrPort // UDP
+  wide   bool           // --udp-counters-64bit
+
+  bytes atomic.Int64
+  mu    sync.Mutex // statistik UDP penerima + snapshot omit
+  packets, errors, outOfOrder       int64
+  jitter, prevTransit               float64 // detik
+  haveTransit                       bool
+  omitBytes, omitPackets, omitErrors int64
+}
+
+type i3Test struct {
+  cookie string
+  ip     string
+  p      i3Params
+  n      int // jumlah stream (x2 kalau bidir)
+  blk    int
+
+  mu      sync.Mutex
+  streams []*i3Stream
+  joined  chan struct{}
+  ctx     context.Context
+  cancel  context.CancelCauseFunc
+}
+
+type iperf3Server struct {
+  ln  net.Listener
+  udp *net.UDPConn
+
+  mu     sync.Mutex
+  tests  map[string]*i3Test // per cookie
+  byAddr map[netip.AddrPort]*i3Stream
+  wg     sync.WaitGroup
+  seq    atomic.Uint64
+}
+
+var (
+  errI3Shutdown = errors.New("node shutting down")
+  errI3Limit    = errors.New("MAX_DURATION_SEC reached")
+  errI3Quota    = errors.New("egress quota exhausted")
+)
+
+func startIperf3(addr string) (*iperf3Server, error) {
+  ln, err := net.Listen("tcp", addr)
+  if err != nil { return nil, err }
+  ua, err := net.ResolveUDPAddr("udp", ln.Addr().String()) // UDP di nomor port yang sama
+  if err != nil { ln.Close(); return nil, err }
+  uc, err := net.ListenUDP("udp", ua)
+  if err != nil { ln.Close(); return nil, err }
+  _ = uc.SetReadBuffer(4 << 20)
+  _ = uc.SetWriteBuffer(4 << 20)
+  s := &iperf3Server{ln: ln, udp: uc, tests: map[string]*i3Test{}, byAddr: map[netip.AddrPort]*i3Stream{}}
+  go s.serve()
+  go s.serveUDP()
+  return s, nil
+}
+
+func (s *iperf3Server) serve() {
+  for {
+    c, err := s.ln.Accept()
+    if errors.Is(err, net.ErrClosed) { return }
+    if err != nil { log.Printf("iperf3: %v", err); time.Sleep(100 * time.Millisecond); continue }
+    go s.handle(c, s.seq.Add(1))
+  }
+}
+
+// Shutdown: tolak koneksi baru; tes yang masih jalan ditunggu, lalu di-SERVER_TERMINATE saat ctx habis.
+func (s *iperf3Server) Shutdown(ctx context.Context) error {
+  err := s.ln.Close()
+  done := make(chan struct{})
+  go func() { s.wg.Wait(); close(done) }()
+  select {
+  case <-done:
+  case <-ctx.Done():
+    s.mu.Lock()
+    for _, t := range s.tests { t.cancel(errI3Shutdown) }
+    s.mu.Unlock()
+    s.wg.Wait()
+  }
+  _ = s.udp.Close()
+  return err
+}
+
+// handle: 37 byte pertama = cookie. Cookie tes yang sedang menunggu stream = koneksi data,
+// selain itu koneksi kontrol tes baru.
+func (s *iperf3Server) handle(c net.Conn, seq uint64) {
+  _ = c.SetReadDeadline(time.Now().Add(10 * time.Second))
+  buf := make([]byte, i3CookieSize)
+  if _, err := io.ReadFull(c, buf); err != nil { c.Close(); return }
+  _ = c.SetReadDeadline(time.Time{})
+  cookie := strings.TrimRight(string(buf), "\x00")
+
+  s.mu.Lock()
+  t := s.tests[cookie]
+  s.mu.Unlock()
+  if t != nil {
+    if !t.join(&i3Stream{seq: seq, conn: c}) { c.Close() }
+    return
+  }
+  defer c.Close()
+  s.control(c, cookie)
+}
+
+func i3State(c net.Conn, st int8) error {
+  _ = c.SetWriteDeadline(time.Now().Add(5 * time.Second))
+  _, err := c.Write([]byte{byte(st)})
+  return err
+}
+
+func i3WriteJSON(c net.Conn, v any) error {
+  b, err := json.Marshal(v)
+  if err != nil { return err }
+  msg := binary.BigEndian.AppendUint32(nil, uint32(len(b)))
+  _ = c.SetWriteDeadline(time.Now().Add(5 * time.Second))
+  _, err = c.Write(append(msg, b...))
+  return err
+}
+
+func i3ReadJSON(c net.Conn, v any) error {
+  _ = c.SetReadDeadline(time.Now().Add(10 * time.Second))
+  defer c.SetReadDeadline(time.Time{})
+  var hdr [4]byte
+  if _, err := io.ReadFull(c, hdr[:]); err != nil { return err }
+  n := binary.BigEndian.Uint32(hdr[:])
+  if n > i3MaxJSON { return fmt.Errorf("json message too large (%d bytes)", n) }
+  b := make([]byte, n)
+  if _, err := io.ReadFull(c, b); err != nil { return err }
+  if v == nil { return nil }
+  return json.Unmarshal(b, v)
+}
+
+// join: stream data baru (TCP atau UDP) untuk tes yang sedang CREATE_STREAMS. Setelah
+// lengkap, stream diurutkan menurut urutan accept (cookie dibaca paralel) lalu diberi ID
+// ala iperf3 (1, 3, 4, 5, ...) dan arah yang sama dengan sisi klien.
+func (t *i3Test) join(st *i3Stream) bool {
+  t.mu.Lock()
+  defer t.mu.Unlock()
+  if len(t.streams) >= t.n || t.ctx.Err() != nil { return false }
+  t.streams = append(t.streams, st)
+  if len(t.streams) < t.n { return true }
+
+  slices.SortFunc(t.streams, func(a, b *i3Stream) int { return cmp.Compare(a.seq, b.seq) })
+  for i, st := range t.streams {
+    st.id = 1
+    if i > 0 { st.id = i + 2 }
+    st.sender = t.p.Reverse
+    if t.p.Bidirectional { st.sender = i >= t.n/2 } // klien membuka stream kirimnya dulu
+    st.wide = t.p.UDPCounters64 != 0
+    if tc := tcpConnOf(st.conn); tc != nil {
+      if t.p.Window > 0 { _ = tc.SetReadBuffer(t.p.Window); _ = tc.SetWriteBuffer(t.p.Window) }
+      if t.p.Congestion != "" { _ = setCC(tc, t.p.Congestion) }
+    }
+  }
+  close(t.joined)
+  return true
+}
+
+func (t *i3Test) nodeSends() bool { return t.p.Reverse || t.p.Bidirectional }
+
+func (s *iperf3Server) control(c net.Conn, cookie string) {
+  ip, _, _ := net.SplitHostPort(c.RemoteAddr().String())
+  deny := func(reason string) {
+    metrics.reject(reason)
+    log.Printf("iperf3: %s denied (%s)", ip, reason)
+    _ = i3State(c, i3AccessDenied)
+  }
+  if refusingTests() { deny(nodeState()); return }
+  if i3State(c, i3ParamExchange) != nil { return }
+  t := &i3Test{cookie: cookie, ip: ip, joined: make(chan struct{})}
+  if err := i3ReadJSON(c, &t.p); err != nil { log.Printf("iperf3: %s: bad parameters: %v", ip, err); return }
+  p := &t.p
+  if !p.TCP && !p.UDP { deny("protocol"); return }
+  if p.Congestion != "" && (!p.TCP || !slices.Contains(ccAlgos, p.Congestion)) { p.Congestion = "" } // diabaikan, seperti iperf3 di non-Linux
+  t.n = max(p.Parallel, 1)
+  if p.Bidirectional { t.n *= 2 }
+  t.blk = p.Len
+  if t.blk <= 0 { t.blk = 128 << 10; if p.UDP { t.blk = 1460 } }
+  t.blk = min(t.blk, payloadChunkSize)
+  if p.UDP { t.blk = min(max(t.blk, 16), 65507) }
+
+  // limit node: slot stream per client (semua stream harus muat), kuota egress kalau node mengirim
+  if t.n > limits.Load().MaxStreams { deny("streams"); return }
+  if t.nodeSends() && quota.left(ip) == 0 { deny("quota"); return }
+  for i := range t.n {
+    if !admit.acquire(ip) {
+      for range i { admit.release(ip) }
+      deny("streams")
+      return
+    }
+  }
+  defer func() { for range t.n { admit.release(ip) } }()
+
+  t.ctx, t.cancel = context.WithCancelCause(context.Background())
+  s.wg.Add(1)
+  defer s.wg.Done()
+  s.mu.Lock()
+  s.tests[cookie] = t
+  s.mu.Unlock()
+  defer func() {
+    t.mu.Lock()
+    t.cancel(nil) // join berikutnya ditolak
+    streams := t.streams
+    t.mu.Unlock()
+    s.mu.Lock()
+    delete(s.tests, cookie)
+    for _, st := range streams { if st.addr.IsValid() { delete(s.byAddr, st.addr) } }
+    s.mu.Unlock()
+    for _, st := range streams { if st.conn != nil { st.conn.Close() } }
+  }()
+
+  if i3State(c, i3CreateStreams) != nil { return }
+  // koneksi kontrol: satu byte state dari klien (TEST_END / CLIENT_TERMINATE / EOF)
+  ctrl := make(chan int8, 1)
+  readState := func() {
+    var b [1]byte
+    if _, err := io.ReadFull(c, b[:]); err != nil { ctrl <- i3ClientTerminate; return }
+    ctrl <- int8(b[0])
+  }
+  go readState()
+
+  select {
+  case <-t.joined:
+  case <-ctrl: // klien menyerah sebelum stream lengkap
+    return
+  case <-t.ctx.Done():
+    _ = i3State(c, i3ServerTerminate)
+    return
+  case <-time.After(10 * time.Second):
+    log.Printf("iperf3: %s: timeout waiting for %d stream(s)", ip, t.n)
+    _ = i3State(c, i3ServerTerminate)
+    return
+  }
+
+  if i3State(c, i3TestStart) != nil { return }
+  start := time.Now()
+  var wg sync.WaitGroup
+  for _, st := range t.streams {
+    wg.Add(1)
+    go func() { defer wg.Done(); s.runStream(t, st, start) }()
+  }
+  if i3State(c, i3TestRunning) != nil { t.cancel(nil); wg.Wait(); return }
+  if p.Omit > 0 {
+    omit := time.AfterFunc(time.Duration(p.Omit)*time.Second, t.omitDone)
+    defer omit.Stop()
+  }
+
+  // klien yang menentukan akhir tes; node hanya memotong di MAX_DURATION_SEC
+  want := time.Duration(p.Time+p.Omit) * time.Second
+  limit := time.Duration(limits.Load().MaxDurationSec) * time.Second
+  if p.Time > 0 && want <= limit { limit = want + 5*time.Second }
+  timer := time.NewTimer(limit)
+  defer timer.Stop()
+
+  var state int8
+  select {
+  case state = <-ctrl:
+  case <-timer.C:
+    t.cancel(errI3Limit)
+  case <-t.ctx.Done():
+  }
+  t.cancel(nil) // hentikan pengirim/penerima
+  wg.Wait()
+  el := time.Since(start)
+  if state != i3TestEnd {
+    cause := context.Cause(t.ctx)
+    if state == i3ClientTerminate || errors.Is(cause, context.Canceled) {
+      log.Printf("iperf3: %s: client terminated after %s", ip, el.Round(time.Millisecond))
+      return
+    }
+    log.Printf("iperf3: %s: terminating test: %v", ip, cause)
+    _ = i3State(c, i3ServerTerminate)
+    return
+  }
+
+  if i3State(c, i3ExchangeResults) != nil { return }
+  if err := i3ReadJSON(c, nil); err != nil { return } // hasil klien tidak dipakai
+  if err := i3WriteJSON(c, t.results(el)); err != nil { return }
+  if i3State(c, i3DisplayResults) != nil { return }
+  _ = c.SetReadDeadline(time.Now().Add(5 * time.Second))
+  go readState()
+  <-ctrl // IPERF_DONE (atau koneksi ditutup)
+  log.Printf("iperf3: %s: %s", ip, t.summary(el))
+}
+
+// omitDone: akhir -O, counter yang sudah ada tidak ikut hasil (sama seperti iperf3).
+func (t *i3Test) omitDone() {
+  for _, st := range t.streams {
+    st.mu.Lock()
+    st.omitBytes, st.omitPackets, st.omitErrors = st.bytes.Load(), st.packets, st.errors
+    st.jitter = 0
+    st.mu.Unlock()
+  }
+}
+
+func (s *iperf3Server) runStream(t *i3Test, st *i3Stream, start time.Time) {
+  if st.sender {
+    metrics.activeDown.Add(1)
+    defer metrics.activeDown.Add(-1)
+  } else {
+    metrics.activeUp.Add(1)
+    defer metrics.activeUp.Add(-1)
+  }
+  if st.conn != nil {
+    stop := context.AfterFunc(t.ctx, func() { _ = st.conn.SetDeadline(time.Now()) })
+    defer stop()
+  }
+  switch {
+  case st.sender && st.conn != nil:
+    s.sendTCP(t, st)
+  case st.sender:
+    s.sendUDP(t, st, start)
+  case st.conn != nil:
+    buf := make([]byte, max(t.blk, 128<<10))
+    for {
+      n, err := st.conn.Read(buf)
+      st.bytes.Add(int64(n))
+      metrics.bytesReceived.Add(int64(n))
+      if err != nil { return }
+    }
+  default: // UDP masuk diproses serveUDP
+    <-t.ctx.Done()
+  }
+}
+
+func (t *i3Test) payload() payload {
+  if t.p.RepeatingPayload != 0 { return repeatPayload{} }
+  gen, _ := newPayload("")
+  return gen
+}
+
+func (s *iperf3Server) sendTCP(t *i3Test, st *i3Stream) {
+  gen := t.payload()
+  buf := make([]byte, t.blk)
+  for t.ctx.Err() == nil {
+    gen.fill(buf)
+    allowed := quota.add(t.ip, len(buf))
+    n, err := st.conn.Write(buf[:allowed])
+    st.bytes.Add(int64(n))
+    metrics.bytesSent.Add(int64(n))
+    if err != nil { return }
+    if allowed < len(buf) { t.cancel(errI3Quota); return }
+    if t.p.Num > 0 && st.bytes.Load() >= t.p.Num { return } // -n: klien menghentikan tes
+  }
+}
+
+// sendUDP: datagram ber-header iperf3 (detik, mikrodetik, nomor paket big-endian), dipacing ke -b.
+func (s *iperf3Server) sendUDP(t *i3Test, st *i3Stream, start time.Time) {
+  gen := t.payload()
+  buf := make([]byte, t.blk)
+  gen.fill(buf)
+  rate := float64(t.p.Bandwidth) / 8 // byte/s, 0 = tanpa batas
+  var pkts uint64
+  for t.ctx.Err() == nil {
+    if rate > 0 {
+      if ahead := float64(st.bytes.Load()) - rate*time.Since(start).Seconds(); ahead > 0 {
+        time.Sleep(min(time.Duration(ahead/rate*float64(time.Second)), 10*time.Millisecond))
+        continue
+      }
+    }
+    pkts++
+    now := time.Now()
+    binary.BigEndian.PutUint32(buf[0:], uint32(now.Unix()))
+    binary.BigEndian.PutUint32(buf[4:], uint32(now.Nanosecond()/1000))
+    if st.wide && len(buf) >= 16 {
+      binary.BigEndian.PutUint64(buf[8:], pkts)
+    } else {
+      binary.BigEndian.PutUint32(buf[8:], uint32(pkts))
+    }
+    // datagram tidak bisa dipotong: kalau kuota tidak cukup untuk satu paket, berhenti
+    if quota.add(t.ip, len(buf)) < len(buf) { t.cancel(errI3Quota); return }
+    n, err := s.udp.WriteToUDPAddrPort(buf, st.addr)
+    if err != nil { continue } // ENOBUFS dsb: paket dianggap hilang
+    st.mu.Lock()
+    st.packets = int64(pkts)
+    st.mu.Unlock()
+    st.bytes.Add(int64(n))
+    metrics.bytesSent.Add(int64(n))
+  }
+}
+
+// serveUDP: satu socket untuk semua tes UDP, stream dikenali dari alamat asal.
+func (s *iperf3Server) serveUDP() {
+  buf := make([]byte, 65536)
+  for {
+    n, from, err := s.udp.ReadFromUDPAddrPort(buf)
+    if errors.Is(err, net.ErrClosed) { return }
+    if err != nil { continue }
+    from = netip.AddrPortFrom(from.Addr().Unmap(), from.Port())
+    now := time.Now()
+    s.mu.Lock()
+    st := s.byAddr[from]
+    s.mu.Unlock()
+    if n == 4 {
+      s.udpConnect(from, buf[:4], st)
+      continue
+    }
+    if st == nil || st.sender || n < 12 { continue }
+    st.bytes.Add(int64(n))
+    metrics.bytesReceived.Add(int64(n))
+    st.recvUDP(buf[:n], now)
+  }
+}
+
+// udpConnect: datagram 4 byte pembuka stream UDP. Dicocokkan ke tes UDP dari IP yang sama
+// yang masih menunggu stream; pengulangan connect dari alamat yang sudah terdaftar dijawab lagi.
+func (s *iperf3Server) udpConnect(from netip.AddrPort, msg []byte, st *i3Stream) {
+  var reply []byte
+  for _, m := range i3UDPConnect {
+    switch m[0] {
+    case binary.LittleEndian.Uint32(msg): reply = binary.LittleEndian.AppendUint32(nil, m[1])
+    case binary.BigEndian.Uint32(msg): reply = binary.BigEndian.AppendUint32(nil, m[1])
+    }
+  }
+  if reply == nil { return }
+  if st == nil {
+    s.mu.Lock()
+    for _, t := range s.tests {
+      if !t.p.UDP || t.ip != from.Addr().String() { continue }
+      cand := &i3Stream{seq: s.seq.Add(1), addr: from}
+      if t.join(cand) { st = cand; s.byAddr[from] = st; break }
+    }
+    s.mu.Unlock()
+    if st == nil { return }
+  }
+  _, _ = s.udp.WriteToUDPAddrPort(reply, from)
+}
+
+// recvUDP: hitung paket, loss, out-of-order dan jitter RFC 1889 persis seperti iperf3.
+func (st *i3Stream) recvUDP(b []byte, now time.Time) {
+  sec, usec := binary.BigEndian.Uint32(b[0:]), binary.BigEndian.Uint32(b[4:])
+  pcount := int64(binary.BigEndian.Uint32(b[8:]))
+  if st.wide && len(b) >= 16 { pcount = int64(binary.BigEndian.Uint64(b[8:])) }
+  st.mu.Lock()
+  defer st.mu.Unlock()
+  if pcount >= st.packets+1 {
+    if pcount > st.packets+1 { st.errors += pcount - 1 - st.packets }
+    st.packets = pcount
+  } else {
+    st.outOfOrder++
+    if st.errors > 0 { st.errors-- }
+  }
+  sent := float64(sec) + float64(usec)/1e6
+  transit := float64(now.UnixMicro())/1e6 - sent
+  if st.haveTransit {
+    d := transit - st.prevTransit
+    if d < 0 { d = -d }
+    st.jitter += (d - st.jitter) / 16
+  }
+  st.prevTransit, st.haveTransit = transit, true
+}
+
+// results: JSON hasil sisi server dalam format iperf3 (dibaca klien di EXCHANGE_RESULTS).
+func (t *i3Test) results(el time.Duration) map[string]any {
+  retrans := -1 // node tidak mengirim
+  if t.nodeSends() { retrans = 0 }
+  streams := []map[string]any{}
+  cc := ""
+  for _, st := range t.streams {
+    st.mu.Lock()
+    r := map[string]any{
+      "id": st.id, "bytes": st.bytes.Load() - st.omitBytes, "retransmits": -1,
+      "jitter": st.jitter, "errors": st.errors, "omitted_errors": st.omitErrors,
+      "packets": st.packets, "omitted_packets": st.omitPackets,
+      "start_time": 0, "end_time": el.Seconds(),
+    }
+    st.mu.Unlock()
+    if ti := connTCPInfo(st.conn); ti != nil {
+      if st.sender { r["retransmits"], retrans = ti.Retransmits, 1 }
+      if cc == "" { cc = ti.CC }
+    }
+    streams = append(streams, r)
+  }
+  res := map[string]any{
+    "cpu_util_total": 0.0, "cpu_util_user": 0.0, "cpu_util_system": 0.0,
+    "sender_has_retransmits": retrans, "streams": streams,
+  }
+  if cc != "" { res["congestion_used"] = cc }
+  if t.p.GetServerOutput != 0 { res["server_output_text"] = t.serverOutput(el) }
+  return res
+}
+
+func (t *i3Test) serverOutput(el time.Duration) string {
+  var b strings.Builder
+  fmt.Fprintf(&b, "Accepted connection from %s (speedtest-node)\n[ ID] Interval           Transfer     Bitrate\n", t.ip)
+  for _, st := range t.streams {
+    role := "receiver"
+    if st.sender { role = "sender" }
+    n := st.bytes.Load() - st.omitBytes
+    fmt.Fprintf(&b, "[%3d] 0.00-%.2f sec  %.1f MBytes  %.1f Mbits/sec  %s\n", st.id, el.Seconds(), float64(n)/(1<<20), mbps(n, el), role)
+  }
+  return b.String()
+}
+
+func (t *i3Test) summary(el time.Duration) string {
+  var sent, recv int64
+  for _, st := range t.streams {
+    if st.sender { sent += st.bytes.Load() } else { recv += st.bytes.Load() }
+  }
+  proto := "tcp"
+  if t.p.UDP { proto = "udp" }
+  return fmt.Sprintf("%s %d stream(s) %s, sent %.1f Mbps, received %.1f Mbps", proto, t.n, el.Round(time.Millisecond), mbps(sent, el), mbps(recv, el))
+}
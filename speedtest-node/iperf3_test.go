@@ -0,0 +1,160 @@
+package main
+
+import (
+  "context"
+  "encoding/binary"
+  "io"
+  "net"
+  "strings"
+  "testing"
+  "time"
+)
+
+func TestI3JSONFraming(t *testing.T) {
+  a, b := net.Pipe()
+  defer a.Close()
+  defer b.Close()
+
+  go i3WriteJSON(a, map[string]any{"tcp": true, "time": 3})
+  var hdr [4]byte
+  if _, err := io.ReadFull(b, hdr[:]); err != nil { t.Fatal(err) }
+  body := make([]byte, binary.BigEndian.Uint32(hdr[:]))
+  if _, err := io.ReadFull(b, body); err != nil { t.Fatal(err) }
+  if string(body) != `{"tcp":true,"time":3}` { t.Errorf("framed body = %s", body) }
+
+  go i3WriteJSON(a, i3Params{TCP: true, Parallel: 4, Reverse: true})
+  var p i3Params
+  if err := i3ReadJSON(b, &p); err != nil { t.Fatal(err) }
+  if !p.TCP || p.Parallel != 4 || !p.Reverse { t.Errorf("round trip = %+v", p) }
+
+  go i3WriteJSON(a, map[string]any{"ignored": 1})
+  if err := i3ReadJSON(b, nil); err != nil { t.Errorf("discarding message: %v", err) }
+
+  // panjang di atas i3MaxJSON ditolak tanpa membaca isinya
+  go a.Write(binary.BigEndian.AppendUint32(nil, i3MaxJSON+1))
+  if err := i3ReadJSON(b, nil); err == nil || !strings.Contains(err.Error(), "too large") { t.Errorf("oversized message: err = %v", err) }
+}
+
+func TestI3JoinOrder(t *testing.T) {
+  ctx, cancel := context.WithCancelCause(context.Background())
+  defer cancel(nil)
+  // --bidir -P 2: klien membuka 2 stream kirim lalu 2 stream terima
+  tt := &i3Test{p: i3Params{TCP: true, Bidirectional: true, Parallel: 2}, n: 4, joined: make(chan struct{}), ctx: ctx, cancel: cancel}
+  for _, seq := range []uint64{12, 10, 13, 11} { // cookie dibaca paralel: urutan join acak
+    if !tt.join(&i3Stream{seq: seq}) { t.Fatalf("join seq %d rejected", seq) }
+  }
+  select {
+  case <-tt.joined:
+  default:
+    t.Fatal("joined not closed after all streams")
+  }
+  wantID, wantSender := []int{1, 3, 4, 5}, []bool{false, false, true, true}
+  for i, st := range tt.streams {
+    if st.seq != uint64(10+i) || st.id != wantID[i] || st.sender != wantSender[i] {
+      t.Errorf("stream %d: seq=%d id=%d sender=%v, want seq=%d id=%d sender=%v", i, st.seq, st.id, st.sender, 10+i, wantID[i], wantSender[i])
+    }
+  }
+  if tt.join(&i3Stream{seq: 14}) { t.Error("extra stream accepted") }
+}
+
+// i3TestClient meniru sisi kontrol iperf3 -c.
+type i3TestClient struct {
+  t *testing.T
+  c net.Conn
+}
+
+func (ic *i3TestClient) expect(want int8) {
+  ic.t.Helper()
+  var b [1]byte
+  if _, err := io.ReadFull(ic.c, b[:]); err != nil { ic.t.Fatalf("waiting for state %d: %v", want, err) }
+  if int8(b[0]) != want { ic.t.Fatalf("state = %d, want %d", int8(b[0]), want) }
+}
+
+func dialIperf3(t *testing.T, addr, cookie string) net.Conn {
+  t.Helper()
+  c, err := net.Dial("tcp", addr)
+  if err != nil { t.Fatal(err) }
+  t.Cleanup(func() { c.Close() })
+  _ = c.SetDeadline(time.Now().Add(10 * time.Second))
+  ck := make([]byte, i3CookieSize) // 36 karakter + NUL
+  copy(ck, cookie)
+  if _, err := c.Write(ck); err != nil { t.Fatal(err) }
+  return c
+}
+
+func startTestIperf3(t *testing.T) string {
+  t.Helper()
+  s, err := startIperf3("127.0.0.1:0")
+  if err != nil { t.Fatal(err) }
+  t.Cleanup(func() {
+    ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+    defer cancel()
+    s.Shutdown(ctx)
+  })
+  return s.ln.Addr().String()
+}
+
+func TestIperf3ReverseTCP(t *testing.T) {
+  setTestLimits(t, testLimits)
+  addr := startTestIperf3(t)
+  cookie := strings.Repeat("a", i3CookieSize-1)
+
+  ic := &i3TestClient{t: t, c: dialIperf3(t, addr, cookie)}
+  ic.expect(i3ParamExchange)
+  if err := i3WriteJSON(ic.c, i3Params{TCP: true, Time: 1, Parallel: 1, Reverse: true, GetServerOutput: 1}); err != nil { t.Fatal(err) }
+  ic.expect(i3CreateStreams)
+  data := dialIperf3(t, addr, cookie)
+  ic.expect(i3TestStart)
+  ic.expect(i3TestRunning)
+
+  _ = data.SetReadDeadline(time.Now().Add(300 * time.Millisecond))
+  got, _ := io.Copy(io.Discard, data)
+  if got == 0 { t.Fatal("no data received on reverse stream") }
+  if _, err := ic.c.Write([]byte{i3TestEnd}); err != nil { t.Fatal(err) }
+
+  ic.expect(i3ExchangeResults)
+  if err := i3WriteJSON(ic.c, map[string]any{"streams": []any{}}); err != nil { t.Fatal(err) }
+  var res struct {
+    Streams []struct {
+      ID    int   `json:"id"`
+      Bytes int64 `json:"bytes"`
+    } `json:"streams"`
+    ServerOutput string `json:"server_output_text"`
+  }
+  if err := i3ReadJSON(ic.c, &res); err != nil { t.Fatal(err) }
+  if len(res.Streams) != 1 || res.Streams[0].ID != 1 || res.Streams[0].Bytes < got {
+    t.Errorf("server results = %+v, client read %d bytes", res.Streams, got)
+  }
+  if !strings.Contains(res.ServerOutput, "sender") { t.Errorf("server output = %q", res.ServerOutput) }
+  ic.expect(i3DisplayResults)
+  if _, err := ic.c.Write([]byte{i3IperfDone}); err != nil { t.Fatal(err) }
+}
+
+func TestIperf3AccessDenied(t *testing.T) {
+  setTestLimits(t, testLimits)
+  addr := startTestIperf3(t)
+
+  tests := []struct {
+    name string
+    p    i3Params
+  }{
+    {"too many streams", i3Params{TCP: true, Parallel: testLimits.MaxStreams + 1}},
+    {"bidir doubles streams", i3Params{TCP: true, Parallel: 3, Bidirectional: true}},
+    {"no protocol", i3Params{Parallel: 1}},
+  }
+  for i, tt := range tests {
+    t.Run(tt.name, func(t *testing.T) {
+      ic := &i3TestClient{t: t, c: dialIperf3(t, addr, strings.Repeat(string(rune('b'+i)), i3CookieSize-1))}
+      ic.expect(i3ParamExchange)
+      if err := i3WriteJSON(ic.c, tt.p); err != nil { t.Fatal(err) }
+      ic.expect(i3AccessDenied)
+    })
+  }
+
+  // parameter rusak: koneksi ditutup tanpa CREATE_STREAMS
+  c := dialIperf3(t, addr, strings.Repeat("z", i3CookieSize-1))
+  (&i3TestClient{t: t, c: c}).expect(i3ParamExchange)
+  c.Write(binary.BigEndian.AppendUint32(nil, 3))
+  c.Write([]byte("{x}"))
+  if rest, _ := io.ReadAll(c); len(rest) != 0 { t.Errorf("after bad parameters got %v, want close", rest) }
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+  "encoding/json"
+  "fmt"
+  "net"
+  "net/http"
+  "strconv"
+)
+
+// Route kompatibel LibreSpeed (garbage.php, empty.php, getIP.php) supaya node bisa
+// dipasang sebagai server di front-end/aplikasi LibreSpeed tanpa PHP. Dipasang di
+// root dan di /backend (layout default LibreSpeed).
+
+func registerLibreSpeed(mux *http.ServeMux) {
+  for _, prefix := range []string{"", "/backend"} {
+    mux.HandleFunc(prefix+"/garbage.php", withCORS(withAdmission(lsGarbage)))
+    mux.HandleFunc(prefix+"/empty.php", withCORS(lsEmpty))
+    mux.HandleFunc(prefix+"/getIP.php", withCORS(lsGetIP))
+  }
+}
+
+// lsGarbage: ckSize x 1 MiB data acak (default 4, maks 1024), lewat serveDownload.
+func lsGarbage(w http.ResponseWriter, r *http.Request) {
+  q := r.URL.Query()
+  ck := queryInt(q, "ckSize", 4, 1, 1024)
+  q.Set("bytes", strconv.Itoa(ck*payloadChunkSize)) // profile=, seed=, pattern=, cc= tetap ikut
+  r.URL.RawQuery = q.Encode()
+  w.Header().Set("Content-Description", "File Transfer")
+  w.Header().Set("Content-Disposition", "attachment; filename=random.dat")
+  w.Header().Set("Content-Transfer-Encoding", "binary")
+  serveDownload(w, r, nil)
+}
+
+// lsEmpty: GET = ping, POST = sink upload (body dibuang, respons kosong).
+func lsEmpty(w http.ResponseWriter, r *http.Request) {
+  w.Header().Set("Cache-Control", "no-store, no-cache, must-revalidate, max-age=0")
+  im, err := requestImpairment(r.URL.Query(), nil)
+  if err != nil { http.Error(w, err.Error(), http.StatusBadRequest); return }
+  if r.Method == http.MethodPost {
+    // hanya upload yang makan slot stream
+    if refusingTests() { rejectDraining(w); return }
+    ip := clientIP(r)
+    if !admit.acquire(ip) { rejectBusy(w); return }
+    defer admit.release(ip)
+    receiveUpload(w, r, nil, im, nil)
+  } else {
+    im.wait() // GET empty.php = ping LibreSpeed
+  }
+  w.WriteHeader(http.StatusOK)
+}
+
+// lsGetIP: format getIP.php ({processedString, rawIspInfo}); isp=true menambah ISP dari
+// database GeoIP lokal, rawIspInfo meniru objek ipinfo.io seperti LibreSpeed.
+func lsGetIP(w http.ResponseWriter, r *http.Request) {
+  ip := clientIP(r)
+  processed := ip
+  var raw any = ""
+  if local := localAccess(net.ParseIP(ip)); local != "" {
+    processed = ip + " - " + local
+  } else if r.URL.Query().Get("isp") == "true" {
+    wi := lookupWhoami(ip)
+    if org := wi.orgLabel(); org != "" {
+      processed = ip + " - " + org
+      if wi.Country != "" { processed += ", " + wi.Country }
+    }
+    info := map[string]any{"ip": ip, "org": wi.orgLabel(), "country": wi.Country, "region": wi.Region, "city": wi.City}
+    if wi.Lat != nil && wi.Lon != nil { info["loc"] = fmt.Sprintf("%.4f,%.4f", *wi.Lat, *wi.Lon) }
+    raw = info
+  }
+  w.Header().Set("Content-Type", "application/json; charset=utf-8")
+  w.Header().Set("Cache-Control", "no-store")
+  _ = json.NewEncoder(w).Encode(map[string]any{"processedString": processed, "rawIspInfo": raw})
+}
+
+// localAccess: label alamat non-publik, sama seperti getIP.php LibreSpeed.
+func localAccess(ip net.IP) string {
+  switch {
+  case ip == nil:
+    return ""
+  case ip.IsLoopback() && ip.To4() == nil:
+    return "localhost IPv6 access"
+  case ip.IsLoopback():
+    return "localhost IPv4 access"
+  case ip.IsLinkLocalUnicast() && ip.To4() == nil:
+    return "link-local IPv6 access"
+  case ip.IsLinkLocalUnicast():
+    return "link-local IPv4 access"
+  case ip.IsPrivate() && ip.To4() == nil:
+    return "ULA IPv6 access"
+  case ip.IsPrivate():
+    return "private IPv4 access"
+  case cgnatNet.Contains(ip):
+    return "CGNAT IPv4 access"
+  }
+  return ""
+}
@@ -0,0 +1,27 @@
+package main
+
+import (
+  "bytes"
+  "net/http"
+  "net/http/httptest"
+  "testing"
+)
+
+func TestLibreSpeedGarbageKeepsQuery(t *testing.T) {
+  setTestLimits(t, testLimits)
+  old := impairEnabled
+  impairEnabled = true
+  t.Cleanup(func() { impairEnabled = old })
+
+  // profil 3g tanpa delay/rate supaya tes cepat; yang dicek: parameter sampai ke serveDownload
+  w := httptest.NewRecorder()
+  lsGarbage(w, httptest.NewRequest("GET", "/garbage.php?ckSize=1&profile=3g&seed=42&delayMs=0&jitterMs=0&rateKbps=0&stallProb=0&pattern=zero", nil))
+  if w.Code != http.StatusOK { t.Fatalf("status = %d: %s", w.Code, w.Body) }
+  if got := w.Header().Get("X-Impairment"); got != "3g" { t.Errorf("X-Impairment = %q, want 3g", got) }
+  if w.Body.Len() != payloadChunkSize { t.Errorf("body = %d bytes, want ckSize=1 (%d)", w.Body.Len(), payloadChunkSize) }
+  if !bytes.Equal(w.Body.Bytes(), make([]byte, w.Body.Len())) { t.Error("pattern=zero ignored") }
+
+  w = httptest.NewRecorder()
+  lsGarbage(w, httptest.NewRequest("GET", "/garbage.php?profile=nope", nil))
+  if w.Code != http.StatusBadRequest { t.Errorf("unknown profile: status = %d, want 400", w.Code) }
+}
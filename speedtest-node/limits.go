@@ -0,0 +1,105 @@
+package main
+
+import (
+  "net"
+  "net/http"
+  "strconv"
+  "sync"
+  "sync/atomic"
+  "time"
+)
+
+// Limits yang diiklankan di /api/v1/config dan benar-benar ditegakkan.
+type limitsConfig struct {
+  MaxStreams     int   `json:"maxStreams"`     // per client IP
+  MaxNodeStreams int   `json:"maxNodeStreams"` // total per node
+  MaxDurationSec int   `json:"maxDurationSec"`
+  MaxStreamBytes int64 `json:"maxStreamBytes"` // per stream download/upload
+  RetryAfterSec  int   `json:"retryAfterSec"`
+}
+
+var limits atomic.Pointer[limitsConfig]
+
+func loadLimits() *limitsConfig {
+  return &limitsConfig{
+    MaxStreams:     getenvInt("MAX_STREAMS", 16),
+    MaxNodeStreams: getenvInt("MAX_NODE_STREAMS", 256),
+    MaxDurationSec: getenvInt("MAX_DURATION_SEC", 30),
+    MaxStreamBytes: int64(getenvInt("MAX_STREAM_MB", 2048)) << 20,
+    RetryAfterSec:  getenvInt("RETRY_AFTER_SEC", 5),
+  }
+}
+
+// clampDuration: time= dari klien dipotong ke MAX_DURATION_SEC; 0/negatif = maksimum.
+func clampDuration(sec int64) time.Duration {
+  lim := int64(limits.Load().MaxDurationSec)
+  if sec <= 0 || sec > lim { sec = lim }
+  return time.Duration(sec) * time.Second
+}
+
+// clampBytes: bytes= dari klien dipotong ke MAX_STREAM_MB; 0/negatif = maksimum.
+func clampBytes(n int64) int64 {
+  lim := limits.Load().MaxStreamBytes
+  if n <= 0 || n > lim { n = lim }
+  return n
+}
+
+// admission menghitung stream aktif per client IP dan per node.
+type admission struct {
+  mu    sync.Mutex
+  perIP map[string]int
+  total int
+}
+
+var admit = &admission{perIP: map[string]int{}}
+
+func (a *admission) acquire(ip string) bool {
+  l := limits.Load()
+  a.mu.Lock()
+  defer a.mu.Unlock()
+  if a.total >= l.MaxNodeStreams || a.perIP[ip] >= l.MaxStreams { return false }
+  a.total++
+  a.perIP[ip]++
+  return true
+}
+
+func (a *admission) active() int {
+  a.mu.Lock()
+  defer a.mu.Unlock()
+  return a.total
+}
+
+func (a *admission) release(ip string) {
+  a.mu.Lock()
+  defer a.mu.Unlock()
+  a.total--
+  if a.perIP[ip]--; a.perIP[ip] <= 0 { delete(a.perIP, ip) }
+}
+
+// clientIP: alamat peer, atau alamat dari header forwarding kalau peer-nya ada di TRUSTED_PROXIES.
+func clientIP(r *http.Request) string {
+  host, _, err := net.SplitHostPort(r.RemoteAddr)
+  if err != nil { host = r.RemoteAddr }
+  if ip := net.ParseIP(host); ip != nil && isTrustedProxy(ip) {
+    if fwd := forwardedClient(r); fwd != "" { return fwd }
+  }
+  return host
+}
+
+// rejectBusy: 429 + Retry-After kalau slot stream penuh.
+func rejectBusy(w http.ResponseWriter) {
+  metrics.reject("streams")
+  w.Header().Set("Retry-After", strconv.Itoa(limits.Load().RetryAfterSec))
+  http.Error(w, "too many streams", http.StatusTooManyRequests)
+}
+
+func withAdmission(h http.HandlerFunc) http.HandlerFunc {
+  return func(w http.ResponseWriter, r *http.Request) {
+    // saat drain/maintenance, hanya stream milik sesi yang sudah ada ({id}) yang boleh lanjut
+    if refusingTests() && r.PathValue("id") == "" { rejectDraining(w); return }
+    ip := clientIP(r)
+    if !admit.acquire(ip) { rejectBusy(w); return }
+    defer admit.release(ip)
+    h(w, r)
+  }
+}
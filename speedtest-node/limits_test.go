@@ -0,0 +1,81 @@
+package main
+
+import (
+  "net/http"
+  "net/http/httptest"
+  "testing"
+  "time"
+)
+
+func TestAdmissionCaps(t *testing.T) {
+  setTestLimits(t, limitsConfig{MaxStreams: 2, MaxNodeStreams: 3, MaxDurationSec: 1, MaxStreamBytes: 1 << 20, RetryAfterSec: 7})
+  a := &admission{perIP: map[string]int{}}
+  if !a.acquire("a") || !a.acquire("a") { t.Fatal("first two streams for a rejected") }
+  if a.acquire("a") { t.Error("third stream for a admitted over MAX_STREAMS") }
+  if !a.acquire("b") { t.Fatal("stream for b rejected") }
+  if a.acquire("c") { t.Error("stream admitted over MAX_NODE_STREAMS") }
+  if a.active() != 3 { t.Errorf("active = %d, want 3", a.active()) }
+
+  a.release("a")
+  if !a.acquire("c") { t.Error("slot not freed by release") }
+  a.release("a")
+  a.release("b")
+  a.release("c")
+  if a.active() != 0 || len(a.perIP) != 0 { t.Errorf("after release: active=%d perIP=%v", a.active(), a.perIP) }
+}
+
+// admitRequest: GET lewat handler h dari client ip.
+func admitRequest(h http.HandlerFunc, ip string) *httptest.ResponseRecorder {
+  w := httptest.NewRecorder()
+  r := httptest.NewRequest("GET", "/api/v1/download", nil)
+  r.RemoteAddr = ip + ":1234"
+  h(w, r)
+  return w
+}
+
+func TestWithAdmission(t *testing.T) {
+  setTestLimits(t, limitsConfig{MaxStreams: 1, MaxNodeStreams: 2, MaxDurationSec: 1, MaxStreamBytes: 1 << 20, RetryAfterSec: 7})
+  oldAdmit := admit
+  admit = &admission{perIP: map[string]int{}}
+  t.Cleanup(func() { admit = oldAdmit })
+
+  hold := make(chan struct{})
+  h := withAdmission(func(w http.ResponseWriter, r *http.Request) {
+    if r.RemoteAddr != "192.0.2.9:1234" { <-hold }
+    w.WriteHeader(http.StatusNoContent)
+  })
+  done := make(chan int, 2)
+  for _, ip := range []string{"192.0.2.1", "192.0.2.2"} {
+    go func() { done <- admitRequest(h, ip).Code }()
+  }
+  for deadline := time.Now().Add(2 * time.Second); admit.active() < 2; time.Sleep(time.Millisecond) {
+    if time.Now().After(deadline) { t.Fatalf("active = %d, want 2 held streams", admit.active()) }
+  }
+
+  for _, tt := range []struct{ name, ip string }{{"per client", "192.0.2.1"}, {"per node", "192.0.2.9"}} {
+    w := admitRequest(h, tt.ip)
+    if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") != "7" {
+      t.Errorf("%s limit: status %d Retry-After %q, want 429 / 7", tt.name, w.Code, w.Header().Get("Retry-After"))
+    }
+  }
+
+  close(hold)
+  for range 2 {
+    if code := <-done; code != http.StatusNoContent { t.Errorf("held request: status %d", code) }
+  }
+  if admit.active() != 0 || len(admit.perIP) != 0 { t.Fatalf("slots not released: active=%d perIP=%v", admit.active(), admit.perIP) }
+  if w := admitRequest(h, "192.0.2.9"); w.Code != http.StatusNoContent { t.Errorf("after release: status %d", w.Code) }
+
+  // handler panik (mis. http.ErrAbortHandler): slot tetap dilepas
+  p := withAdmission(func(http.ResponseWriter, *http.Request) { panic(http.ErrAbortHandler) })
+  func() {
+    defer func() { _ = recover() }()
+    admitRequest(p, "192.0.2.1")
+  }()
+  if admit.active() != 0 { t.Errorf("slot leaked after panic: active=%d", admit.active()) }
+
+  draining.Store(true)
+  w := admitRequest(h, "192.0.2.1")
+  draining.Store(false)
+  if w.Code != http.StatusServiceUnavailable || w.Header().Get("Retry-After") != "7" { t.Errorf("draining: status %d", w.Code) }
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+  "bufio"
+  "math"
+  "os"
+  "strconv"
+  "strings"
+  "sync/atomic"
+  "time"
+)
+
+// Load node 0-100 (skala sama dengan kolom load di directory): nilai terbesar dari
+// stream aktif / MAX_NODE_STREAMS, egress & ingress / LINK_CAPACITY_MBPS, dan CPU.
+type loadSnapshot struct {
+  Load         float64 `json:"load"`
+  Streams      int64   `json:"streams"`
+  EgressMbps   float64 `json:"egressMbps"`
+  IngressMbps  float64 `json:"ingressMbps"`
+  CPU          float64 `json:"cpu"` // 0-100, dari /proc/stat (0 kalau tidak tersedia)
+  CapacityMbps int     `json:"capacityMbps"`
+}
+
+var nodeLoad atomic.Pointer[loadSnapshot]
+
+func currentLoad() loadSnapshot {
+  if l := nodeLoad.Load(); l != nil { return *l }
+  return loadSnapshot{}
+}
+
+// cpuTimes: total & idle jiffies dari baris "cpu" di /proc/stat.
+func cpuTimes() (total, idle uint64, ok bool) {
+  f, err := os.Open("/proc/stat")
+  if err != nil { return 0, 0, false }
+  defer f.Close()
+  sc := bufio.NewScanner(f)
+  if !sc.Scan() { return 0, 0, false }
+  fields := strings.Fields(sc.Text())
+  if len(fields) < 5 || fields[0] != "cpu" { return 0, 0, false }
+  for i, s := range fields[1:] {
+    v, _ := strconv.ParseUint(s, 10, 64)
+    total += v
+    if i == 3 || i == 4 { idle += v } // idle + iowait
+  }
+  return total, idle, true
+}
+
+func round1(v float64) float64 { return math.Round(v*10) / 10 }
+
+// loadSampler menghitung ulang load tiap detik (EWMA supaya tidak loncat-loncat).
+func loadSampler(capacityMbps int) {
+  const alpha = 0.5
+  lastSent, lastRecv := metrics.bytesSent.Load(), metrics.bytesReceived.Load()
+  lastTotal, lastIdle, cpuOK := cpuTimes()
+  last := time.Now()
+  var egress, ingress, cpu float64
+
+  for range time.Tick(time.Second) {
+    now := time.Now()
+    dt := now.Sub(last).Seconds()
+    sent, recv := metrics.bytesSent.Load(), metrics.bytesReceived.Load()
+    egress = alpha*(float64(sent-lastSent)*8/dt/1e6) + (1-alpha)*egress
+    ingress = alpha*(float64(recv-lastRecv)*8/dt/1e6) + (1-alpha)*ingress
+    lastSent, lastRecv, last = sent, recv, now
+
+    if total, idle, ok := cpuTimes(); ok && cpuOK && total > lastTotal {
+      busy := 1 - float64(idle-lastIdle)/float64(total-lastTotal)
+      cpu = alpha*busy*100 + (1-alpha)*cpu
+      lastTotal, lastIdle = total, idle
+    }
+
+    streams := metrics.activeDown.Load() + metrics.activeUp.Load()
+    l := 100 * float64(streams) / float64(max(1, limits.Load().MaxNodeStreams))
+    if capacityMbps > 0 {
+      l = max(l, 100*egress/float64(capacityMbps), 100*ingress/float64(capacityMbps))
+    }
+    l = min(100, max(l, cpu))
+    if quota.nodeExhausted() { l = 100 } // budget egress habis: directory mengarahkan klien ke node lain
+
+    nodeLoad.Store(&loadSnapshot{
+      Load: round1(l), Streams: streams, EgressMbps: round1(egress), IngressMbps: round1(ingress),
+      CPU: round1(cpu), CapacityMbps: capacityMbps,
+    })
+  }
+}
@@ -3,27 +3,63 @@ package main
 import (
   "crypto/rand"
   "encoding/json"
-  "io"
+  "fmt"
   "log"
   "net/http"
+  "net/url"
   "os"
+  "os/signal"
+  "slices"
   "strconv"
+  "strings"
+  "sync/atomic"
+  "syscall"
   "time"
 )
 
-var chunk = make([]byte, 1<<20) // 1 MiB random
+var chunk = make([]byte, payloadChunkSize) // 1 MiB random, untuk pattern=repeat
 
+// getenv: env var, lalu CONFIG_FILE (config.go), lalu default.
 func getenv(k, def string) string {
   if v := os.Getenv(k); v != "" { return v }
+  if v := fileValue(k); v != "" { return v }
   return def
 }
 func getenvInt(k string, def int) int {
-  if v := os.Getenv(k); v != "" {
+  if v := getenv(k, ""); v != "" {
     if n, err := strconv.Atoi(v); err == nil { return n }
   }
   return def
 }
 
+// CORS_ORIGINS: daftar origin yang boleh (mis. https://speedtest.example.com); kosong = semua.
+var corsOrigins atomic.Pointer[[]string]
+
+func checkCORSOrigin(o string) error {
+  if o == "*" { return nil }
+  u, err := url.Parse(o)
+  if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || (u.Path != "" && u.Path != "/") || u.RawQuery != "" {
+    return fmt.Errorf("origin %q must be scheme://host[:port]", o)
+  }
+  return nil
+}
+
+func loadCORSOrigins(list string) {
+  var out []string
+  for _, o := range strings.Split(list, ",") {
+    if o = strings.TrimRight(strings.TrimSpace(o), "/"); o == "" { continue }
+    if err := checkCORSOrigin(o); err != nil { log.Printf("CORS_ORIGINS: %v, ignored", err); continue }
+    if o == "*" { out = nil; break }
+    out = append(out, o)
+  }
+  corsOrigins.Store(&out)
+}
+
+func corsAllowed(origin string) bool {
+  list := corsOrigins.Load()
+  return list == nil || len(*list) == 0 || slices.Contains(*list, origin)
+}
+
 /*func withCORS(h http.HandlerFunc) http.HandlerFunc {
   return func(w http.ResponseWriter, r *http.Request) {
     w.Header().Set("Access-Control-Allow-Origin", "*") // ganti ke domain tertentu di prod
@@ -40,11 +76,17 @@ func withCORS(h http.HandlerFunc) http.HandlerFunc {
     if origin == "" {
       w.Header().Set("Access-Control-Allow-Origin", "*")
     } else {
-      w.Header().Set("Access-Control-Allow-Origin", origin)
       w.Header().Set("Vary", "Origin")
+      if !corsAllowed(origin) { // tanpa header CORS, browser memblokir
+        if r.Method == http.MethodOptions { w.WriteHeader(http.StatusForbidden); return }
+        h(w, r)
+        return
+      }
+      w.Header().Set("Access-Control-Allow-Origin", origin)
     }
-    w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
-    w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+    w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
+    w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-Checksum")
+    w.Header().Set("Access-Control-Expose-Headers", "Retry-After, X-Congestion-Control, X-Quota-Remaining, X-Impairment, Content-Range, ETag")
 
     // >>> penting untuk Private Network Access (akses 192.168.x.x dari browser)
     if r.Header.Get("Access-Control-Request-Private-Network") == "true" {
@@ -61,52 +103,76 @@ func withCORS(h http.HandlerFunc) http.HandlerFunc {
 
 
 func main() {
+  // paling awal: SIGTERM saat listener/servis masih dinyalakan tetap antre dan di-drain
+  signal.Notify(shutdownc, syscall.SIGTERM, os.Interrupt)
   if _, err := rand.Read(chunk); err != nil { panic(err) }
+  // CONFIG_FILE: YAML/JSON; env var yang di-set tetap menimpa isi file
+  if err := loadConfigFile(os.Getenv("CONFIG_FILE")); err != nil { log.Fatal(err) }
+  go watchConfig(time.Duration(getenvInt("CONFIG_RELOAD_SEC", 5)) * time.Second)
+  loadCORSOrigins(getenv("CORS_ORIGINS", ""))
 
   nodeID := getenv("NODE_ID", "node-1")
   region := getenv("REGION", "id-dps")
-  maxDur := getenvInt("MAX_DURATION_SEC", 30)
+  limits.Store(loadLimits())
+  if quota = loadEgressQuota(); quota.enabled {
+    go quota.flusher(time.Duration(getenvInt("QUOTA_FLUSH_SEC", 30)) * time.Second)
+  }
+  if ccAlgos = loadCongestionControls(); len(ccAlgos) > 0 { addCapability("tcp-cc") }
+  // IMPAIRMENT_ENABLED=1: profile=3g dst. untuk QA (jangan aktifkan di node publik)
+  if impairEnabled = getenv("IMPAIRMENT_ENABLED", "") == "1"; impairEnabled {
+    addCapability("impairment")
+    log.Printf("impairment mode enabled (profiles: %s)", strings.Join(impairNames(), ", "))
+  }
   addr   := getenv("ADDR", ":8080")
 
   mux := http.NewServeMux()
 
   mux.HandleFunc("/healthz", withCORS(func(w http.ResponseWriter, r *http.Request) {
+    if refusingTests() { w.WriteHeader(http.StatusServiceUnavailable); _, _ = w.Write([]byte(nodeState())); return }
     w.WriteHeader(200); _, _ = w.Write([]byte("ok"))
   }))
 
+  metrics.setIdentity(nodeID, region)
+  mux.HandleFunc("/metrics", apiMetrics)
+
+  var h3Port int // diisi kalau HTTP/3 aktif
+  var rawTCP *rawTCPServer
+  var iperf3Port int
   mux.HandleFunc("/api/v1/config", withCORS(func(w http.ResponseWriter, r *http.Request) {
+    l := limits.Load()
+    cfg := map[string]any{
+      "nodeId": nodeID, "region": region, "maxStreams": l.MaxStreams, "maxDurationSec": l.MaxDurationSec,
+      "maxNodeStreams": l.MaxNodeStreams, "maxStreamBytes": l.MaxStreamBytes,
+      "load": currentLoad().Load, "loadDetail": currentLoad(), "state": nodeState(),
+    }
+    if h3Port > 0 { cfg["http3Port"] = h3Port }
+    if udpSvc != nil { cfg["udpPort"] = udpSvc.port }
+    if rawTCP != nil { cfg["rawTcpPort"] = portOf(rawTCP.ln.Addr().String()) }
+    if iperf3Port > 0 { cfg["iperf3Port"] = iperf3Port }
+    if len(ccAlgos) > 0 { cfg["congestionControl"] = ccAlgos }
+    if q := quota.snapshot(); q != nil { cfg["quota"] = q }
+    if impairEnabled { cfg["impairmentProfiles"] = impairProfiles }
+    cfg["files"] = fileNames()
     w.Header().Set("Content-Type", "application/json")
-    _ = json.NewEncoder(w).Encode(map[string]any{
-      "nodeId": nodeID, "region": region, "maxStreams": 16, "maxDurationSec": maxDur,
-    })
+    _ = json.NewEncoder(w).Encode(cfg)
   }))
 
+  // IP/ASN/lokasi klien dari database lokal (pengganti ipapi/ipify di client)
+  loadGeoDBs()
+  loadTrustedProxies(getenv("TRUSTED_PROXIES", ""))
+  mux.HandleFunc("/api/v1/whoami", withCORS(apiWhoami))
+  addCapability("whoami")
+
   mux.HandleFunc("/api/v1/latency", withCORS(func(w http.ResponseWriter, r *http.Request) {
+    im, err := requestImpairment(r.URL.Query(), nil)
+    if err != nil { http.Error(w, err.Error(), http.StatusBadRequest); return }
+    im.wait()
     w.WriteHeader(204)
   }))
 
-  mux.HandleFunc("/api/v1/download", withCORS(func(w http.ResponseWriter, r *http.Request) {
-    w.Header().Set("Content-Type", "application/octet-stream")
-    w.Header().Set("Cache-Control", "no-store, no-cache, must-revalidate, proxy-revalidate")
-
-    q := r.URL.Query()
-    timeSec, _ := strconv.ParseInt(q.Get("time"), 10, 64)
-    bytesTarget, _ := strconv.ParseInt(q.Get("bytes"), 10, 64)
-
-    start := time.Now()
-    var deadline time.Time
-    if timeSec > 0 { deadline = start.Add(time.Duration(timeSec) * time.Second) }
-
-    var sent int64
-    fl, _ := w.(http.Flusher)
-    for {
-      if !deadline.IsZero() && time.Now().After(deadline) { break }
-      if bytesTarget > 0 && sent >= bytesTarget { break }
-      if _, err := w.Write(chunk); err != nil { break }
-      sent += int64(len(chunk))
-      if fl != nil { fl.Flush() }
-    }
-  }))
+  mux.HandleFunc("/api/v1/download", withCORS(withAdmission(func(w http.ResponseWriter, r *http.Request) {
+    serveDownload(w, r, nil)
+  })))
 
   /*mux.HandleFunc("/api/v1/upload", withCORS(func(w http.ResponseWriter, r *http.Request) {
     w.Header().Set("Cache-Control", "no-store")
@@ -132,51 +198,136 @@ func main() {
     })
   }))*/
 
-  // PATCH: handler upload yang stabil
-mux.HandleFunc("/api/v1/upload", withCORS(func(w http.ResponseWriter, r *http.Request) {
-  w.Header().Set("Cache-Control", "no-store")
+  // PATCH: handler upload yang stabil (lihat serveUpload)
+  mux.HandleFunc("/api/v1/upload", withCORS(withAdmission(func(w http.ResponseWriter, r *http.Request) {
+    serveUpload(w, r, nil)
+  })))
 
-  // time=... opsional, dipakai sebagai "safety guard"
-  q := r.URL.Query()
-  timeSec, _ := strconv.Atoi(q.Get("time"))
+  // /files/100MB.bin dst. untuk curl/wget/router (Range, HEAD, ETag)
+  if getenv("FILES_ENABLED", "1") != "0" { registerFiles(mux, getenv("FILES", "1MB,10MB,100MB,1GB")) }
 
-  start := time.Now()
+  // garbage.php / empty.php / getIP.php untuk klien LibreSpeed
+  if getenv("LIBRESPEED_ENABLED", "1") != "0" {
+    registerLibreSpeed(mux)
+    addCapability("librespeed")
+  }
 
-  // Guard: kalau klien tak menutup stream, paksa close sedikit setelah durasi
-  var guard *time.Timer
-  if timeSec > 0 {
-    guard = time.AfterFunc(time.Duration(timeSec+1)*time.Second, func() {
-      _ = r.Body.Close() // memicu EOF di loop baca
-    })
-    defer guard.Stop()
+  // build -tags webui: web client + /config.json dari node ini (same-origin)
+  registerWebUI(mux)
+
+  // ADMIN_TOKEN: admin API (limits, maintenance/drain, sesi)
+  if token := getenv("ADMIN_TOKEN", ""); token != "" {
+    registerAdmin(mux, token)
   }
 
-  var received int64
-  buf := make([]byte, 1<<20) // 1 MiB
-  for {
-    n, err := r.Body.Read(buf)
-    if n > 0 { received += int64(n) }
-    if err == io.EOF { break }
-    if err != nil { break }
+  // Sesi tes yang diukur di sisi node
+  mux.HandleFunc("/api/v1/sessions", withCORS(apiCreateSession))
+  mux.HandleFunc("/api/v1/sessions/{id}", withCORS(apiGetSession))
+  mux.HandleFunc("/api/v1/sessions/{id}/download", withCORS(withAdmission(apiSessionDownload)))
+  mux.HandleFunc("/api/v1/sessions/{id}/upload", withCORS(withAdmission(apiSessionUpload)))
+  // WebSocket: RTT dengan timestamp server + download/upload berbingkai WS
+  if getenv("WS_ENABLED", "1") != "0" {
+    mux.HandleFunc("/api/v1/ws", withCORS(apiWS))
+    mux.HandleFunc("/api/v1/sessions/{id}/ws", withCORS(apiSessionWS))
+    addCapability("websocket")
+  }
+  // UDP_ADDR: tes jitter/packet loss (handshake lewat HTTP)
+  if udpAddr := getenv("UDP_ADDR", ""); udpAddr != "" {
+    if err := startUDPService(udpAddr); err != nil { log.Fatal(err) }
+    mux.HandleFunc("/api/v1/udp/sessions", withCORS(apiCreateUDPTest))
+    mux.HandleFunc("/api/v1/udp/sessions/{id}", withCORS(apiGetUDPTest))
+    addCapability("udp")
+    log.Printf("listening on %s/udp (jitter/loss)", udpAddr)
   }
-  _ = r.Body.Close() // rapikan koneksi
 
-  w.Header().Set("Content-Type", "application/json")
-  _ = json.NewEncoder(w).Encode(map[string]any{
-    "receivedBytes": received,
-    "durationMs":    time.Since(start).Milliseconds(),
-  })
-}))
+  // RAW_TCP_ADDR: tes throughput TCP mentah tanpa HTTP (handshake JSON, lihat rawtcp.go)
+  if rawAddr := getenv("RAW_TCP_ADDR", ""); rawAddr != "" {
+    var err error
+    if rawTCP, err = startRawTCP(rawAddr); err != nil { log.Fatal(err) }
+    addCapability("raw-tcp")
+    log.Printf("listening on %s (raw TCP)", rawAddr)
+  }
 
+  // IPERF3_ADDR: server protokol iperf3 (TCP+UDP di port yang sama), ikut limit node
+  var iperf3 *iperf3Server
+  if i3Addr := getenv("IPERF3_ADDR", ""); i3Addr != "" {
+    var err error
+    if iperf3, err = startIperf3(i3Addr); err != nil { log.Fatal(err) }
+    iperf3Port = portOf(iperf3.ln.Addr().String())
+    addCapability("iperf3")
+    log.Printf("listening on %s (iperf3, tcp+udp)", i3Addr)
+  }
 
-  srv := &http.Server{
-    Addr:         addr,
-    Handler:      mux,
-    ReadTimeout:  0,
-    WriteTimeout: 0,
-    IdleTimeout:  120 * time.Second,
+  sessions.ttl = time.Duration(getenvInt("SESSION_TTL_SEC", 600)) * time.Second
+  sessions.max = getenvInt("MAX_SESSIONS", 1000)
+  sessions.maxIP = getenvInt("MAX_SESSIONS_PER_CLIENT", 10)
+  go sessions.janitor()
+
+  go loadSampler(getenvInt("LINK_CAPACITY_MBPS", 1000))
+
+  handler := instrument(mux)
+  newServer := func(addr string) *http.Server {
+    return &http.Server{
+      Addr:         addr,
+      Handler:      handler,
+      ReadTimeout:  0,
+      WriteTimeout: 0,
+      IdleTimeout:  120 * time.Second,
+      ConnContext:  saveConn, // untuk TCP_INFO
+    }
+  }
+  errc := make(chan error, 3)
+  var servers []shutdowner // untuk graceful shutdown
+  if rawTCP != nil { servers = append(servers, rawTCP) }
+  if iperf3 != nil { servers = append(servers, iperf3) }
+
+  log.Printf("Speedtest node %s (%s) (max %d streams/client, %d/node, %ds)",
+    nodeID, region, limits.Load().MaxStreams, limits.Load().MaxNodeStreams, limits.Load().MaxDurationSec)
+
+  // TLS_CERT/TLS_KEY: HTTPS (+h2) di TLS_ADDR dan HTTP tetap di ADDR (dual),
+  // atau HTTPS saja di ADDR kalau TLS_ADDR kosong.
+  certFile, keyFile := getenv("TLS_CERT", ""), getenv("TLS_KEY", "")
+  if certFile != "" && keyFile != "" {
+    certs, err := newCertReloader(certFile, keyFile)
+    if err != nil { log.Fatal(err) }
+    go certs.watch(time.Duration(getenvInt("TLS_RELOAD_SEC", 30)) * time.Second)
+    tlsAddr := getenv("TLS_ADDR", "")
+    if tlsAddr == "" { tlsAddr, addr = addr, "" }
+    tsrv := newServer(tlsAddr)
+    tsrv.TLSConfig = certs.tlsConfig()
+    addCapability("tls", "h2")
+
+    // H3_ADDR: HTTP/3 di UDP, diiklankan lewat Alt-Svc di respons HTTPS
+    if h3Addr := getenv("H3_ADDR", ""); h3Addr != "" {
+      h3 := newHTTP3Server(h3Addr, handler, certs)
+      h3Port = portOf(h3Addr)
+      tsrv.Handler = withAltSvc(h3, handler)
+      addCapability("http3")
+      servers = append(servers, h3)
+      go func() { errc <- h3.ListenAndServe() }()
+      log.Printf("listening on %s/udp (HTTP/3)", h3Addr)
+    }
+    servers = append(servers, tsrv)
+    go func() { errc <- tsrv.ListenAndServeTLS("", "") }()
+    log.Printf("listening on %s (HTTPS, h2)", tlsAddr)
+  }
+  if certFile == "" && getenv("H3_ADDR", "") != "" {
+    log.Printf("H3_ADDR needs TLS_CERT/TLS_KEY, HTTP/3 disabled")
   }
+  startRegistrar(nodeID, region)
 
-  log.Printf("Speedtest node %s (%s) listening on %s", nodeID, region, addr)
-  log.Fatal(srv.ListenAndServe())
+  if addr != "" {
+    srv := newServer(addr)
+    servers = append(servers, srv)
+    go func() { errc <- srv.ListenAndServe() }()
+    log.Printf("listening on %s (HTTP)", addr)
+  }
+
+  select {
+  case err := <-errc:
+    log.Fatal(err)
+  case s := <-shutdownc:
+    log.Printf("%s received", s)
+  }
+  drainAndShutdown(shutdownc, time.Duration(getenvInt("DRAIN_TIMEOUT_SEC", 60))*time.Second, servers)
 }
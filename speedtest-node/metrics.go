@@ -0,0 +1,208 @@
+package main
+
+import (
+  "bufio"
+  "fmt"
+  "net"
+  "net/http"
+  "runtime"
+  "sort"
+  "strconv"
+  "strings"
+  "sync"
+  "sync/atomic"
+  "time"
+)
+
+// Prometheus text format, ditulis manual supaya tidak perlu client_golang.
+// Semua metric diberi label node & region (NODE_ID, REGION).
+
+var durationBuckets = []float64{0.005, 0.01, 0.05, 0.1, 0.5, 1, 5, 10, 30, 60}
+
+type histogram struct {
+  counts []uint64 // per bucket (kumulatif dihitung saat render)
+  sum    float64
+  n      uint64
+}
+
+type reqKey struct{ endpoint, code string }
+
+type nodeMetrics struct {
+  labels string // `node="..",region=".."`
+
+  activeDown    atomic.Int64
+  activeUp      atomic.Int64
+  bytesSent     atomic.Int64
+  bytesReceived atomic.Int64
+  integrityFail atomic.Int64 // upload verify= yang gagal (mismatch/terpotong)
+
+  mu        sync.Mutex
+  requests  map[reqKey]uint64
+  durations map[string]*histogram
+  rejected  map[string]uint64
+}
+
+var metrics = &nodeMetrics{
+  requests:  map[reqKey]uint64{},
+  durations: map[string]*histogram{},
+  rejected:  map[string]uint64{},
+}
+
+func labelValue(s string) string {
+  return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s)
+}
+
+func (m *nodeMetrics) setIdentity(nodeID, region string) {
+  m.labels = fmt.Sprintf(`node="%s",region="%s"`, labelValue(nodeID), labelValue(region))
+}
+
+func (m *nodeMetrics) reject(reason string) {
+  m.mu.Lock()
+  m.rejected[reason]++
+  m.mu.Unlock()
+}
+
+func (m *nodeMetrics) observe(endpoint string, code int, d time.Duration) {
+  m.mu.Lock()
+  defer m.mu.Unlock()
+  m.requests[reqKey{endpoint, strconv.Itoa(code)}]++
+  h := m.durations[endpoint]
+  if h == nil {
+    h = &histogram{counts: make([]uint64, len(durationBuckets))}
+    m.durations[endpoint] = h
+  }
+  sec := d.Seconds()
+  for i, b := range durationBuckets {
+    if sec <= b { h.counts[i]++; break }
+  }
+  h.sum += sec
+  h.n++
+}
+
+// statusRecorder mencatat status code tanpa mematikan Flush/Hijack.
+type statusRecorder struct {
+  http.ResponseWriter
+  code int
+}
+
+func (s *statusRecorder) WriteHeader(code int) {
+  if s.code == 0 { s.code = code }
+  s.ResponseWriter.WriteHeader(code)
+}
+
+func (s *statusRecorder) Write(p []byte) (int, error) {
+  if s.code == 0 { s.code = http.StatusOK }
+  return s.ResponseWriter.Write(p)
+}
+
+func (s *statusRecorder) Flush() {
+  if fl, ok := s.ResponseWriter.(http.Flusher); ok { fl.Flush() }
+}
+
+func (s *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+  hj, ok := s.ResponseWriter.(http.Hijacker)
+  if !ok { return nil, nil, http.ErrNotSupported }
+  if s.code == 0 { s.code = http.StatusSwitchingProtocols }
+  return hj.Hijack()
+}
+
+func (s *statusRecorder) Unwrap() http.ResponseWriter { return s.ResponseWriter }
+
+// instrument membungkus mux; label endpoint = pattern yang cocok (kardinalitas terbatas).
+func instrument(mux *http.ServeMux) http.Handler {
+  return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+    _, pattern := mux.Handler(r)
+    if pattern == "" { pattern = "other" }
+    rec := &statusRecorder{ResponseWriter: w}
+    start := time.Now()
+    mux.ServeHTTP(rec, r)
+    if rec.code == 0 { rec.code = http.StatusOK }
+    metrics.observe(pattern, rec.code, time.Since(start))
+  })
+}
+
+func apiMetrics(w http.ResponseWriter, r *http.Request) {
+  w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+  w.Header().Set("Cache-Control", "no-store")
+  m := metrics
+  b := &strings.Builder{}
+  l := m.labels
+
+  head := func(name, typ, help string) {
+    fmt.Fprintf(b, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+  }
+
+  head("speedtest_active_streams", "gauge", "Active test streams.")
+  fmt.Fprintf(b, "speedtest_active_streams{%s,direction=\"download\"} %d\n", l, m.activeDown.Load())
+  fmt.Fprintf(b, "speedtest_active_streams{%s,direction=\"upload\"} %d\n", l, m.activeUp.Load())
+  head("speedtest_draining", "gauge", "1 while the node refuses new tests (draining or maintenance).")
+  draining := 0
+  if refusingTests() { draining = 1 }
+  fmt.Fprintf(b, "speedtest_draining{%s} %d\n", l, draining)
+  head("speedtest_bytes_sent_total", "counter", "Payload bytes sent to clients.")
+  fmt.Fprintf(b, "speedtest_bytes_sent_total{%s} %d\n", l, m.bytesSent.Load())
+  head("speedtest_bytes_received_total", "counter", "Payload bytes received from clients.")
+  fmt.Fprintf(b, "speedtest_bytes_received_total{%s} %d\n", l, m.bytesReceived.Load())
+  head("speedtest_upload_integrity_failures_total", "counter", "Verified uploads that were altered or truncated.")
+  fmt.Fprintf(b, "speedtest_upload_integrity_failures_total{%s} %d\n", l, m.integrityFail.Load())
+
+  m.mu.Lock()
+  head("speedtest_http_requests_total", "counter", "HTTP requests by endpoint and status code.")
+  keys := make([]reqKey, 0, len(m.requests))
+  for k := range m.requests { keys = append(keys, k) }
+  sort.Slice(keys, func(i, j int) bool {
+    if keys[i].endpoint != keys[j].endpoint { return keys[i].endpoint < keys[j].endpoint }
+    return keys[i].code < keys[j].code
+  })
+  for _, k := range keys {
+    fmt.Fprintf(b, "speedtest_http_requests_total{%s,endpoint=\"%s\",code=\"%s\"} %d\n", l, labelValue(k.endpoint), k.code, m.requests[k])
+  }
+
+  head("speedtest_http_request_duration_seconds", "histogram", "HTTP request duration by endpoint.")
+  eps := make([]string, 0, len(m.durations))
+  for ep := range m.durations { eps = append(eps, ep) }
+  sort.Strings(eps)
+  for _, ep := range eps {
+    h := m.durations[ep]
+    el := fmt.Sprintf(`%s,endpoint="%s"`, l, labelValue(ep))
+    var cum uint64
+    for i, le := range durationBuckets {
+      cum += h.counts[i]
+      fmt.Fprintf(b, "speedtest_http_request_duration_seconds_bucket{%s,le=\"%g\"} %d\n", el, le, cum)
+    }
+    fmt.Fprintf(b, "speedtest_http_request_duration_seconds_bucket{%s,le=\"+Inf\"} %d\n", el, h.n)
+    fmt.Fprintf(b, "speedtest_http_request_duration_seconds_sum{%s} %g\n", el, h.sum)
+    fmt.Fprintf(b, "speedtest_http_request_duration_seconds_count{%s} %d\n", el, h.n)
+  }
+
+  head("speedtest_rejected_requests_total", "counter", "Requests rejected by the node, by reason.")
+  reasons := make([]string, 0, len(m.rejected))
+  for k := range m.rejected { reasons = append(reasons, k) }
+  sort.Strings(reasons)
+  for _, k := range reasons {
+    fmt.Fprintf(b, "speedtest_rejected_requests_total{%s,reason=\"%s\"} %d\n", l, labelValue(k), m.rejected[k])
+  }
+  m.mu.Unlock()
+
+  // Go runtime
+  var ms runtime.MemStats
+  runtime.ReadMemStats(&ms)
+  head("go_info", "gauge", "Go version.")
+  fmt.Fprintf(b, "go_info{%s,version=\"%s\"} 1\n", l, runtime.Version())
+  head("go_goroutines", "gauge", "Number of goroutines.")
+  fmt.Fprintf(b, "go_goroutines{%s} %d\n", l, runtime.NumGoroutine())
+  head("go_memstats_alloc_bytes", "gauge", "Bytes allocated and still in use.")
+  fmt.Fprintf(b, "go_memstats_alloc_bytes{%s} %d\n", l, ms.Alloc)
+  head("go_memstats_heap_inuse_bytes", "gauge", "Bytes in in-use heap spans.")
+  fmt.Fprintf(b, "go_memstats_heap_inuse_bytes{%s} %d\n", l, ms.HeapInuse)
+  head("go_memstats_sys_bytes", "gauge", "Bytes obtained from the OS.")
+  fmt.Fprintf(b, "go_memstats_sys_bytes{%s} %d\n", l, ms.Sys)
+  head("go_memstats_mallocs_total", "counter", "Total heap objects allocated.")
+  fmt.Fprintf(b, "go_memstats_mallocs_total{%s} %d\n", l, ms.Mallocs)
+  head("go_gc_cycles_total", "counter", "Completed GC cycles.")
+  fmt.Fprintf(b, "go_gc_cycles_total{%s} %d\n", l, ms.NumGC)
+  head("go_gc_pause_seconds_total", "counter", "Total GC stop-the-world pause time.")
+  fmt.Fprintf(b, "go_gc_pause_seconds_total{%s} %g\n", l, float64(ms.PauseTotalNs)/1e9)
+
+  _, _ = w.Write([]byte(b.String()))
+}
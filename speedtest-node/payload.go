@@ -0,0 +1,103 @@
+package main
+
+import (
+  "crypto/rand"
+  "encoding/binary"
+  "fmt"
+  "sync"
+)
+
+// payload mengisi buffer download. Tiap stream punya generator sendiri supaya
+// data tidak berulang (middlebox dedup/WAN optimizer tidak bisa "curang").
+type payload interface {
+  fill(p []byte)
+}
+
+const payloadChunkSize = 1 << 20 // 1 MiB per write
+
+var chunkPool = sync.Pool{New: func() any { b := make([]byte, payloadChunkSize); return &b }}
+
+// newPayload: pattern= dari query. Kosong = random.
+//   random  xoshiro256** per stream, seed dari crypto/rand (tidak berulang, tidak bisa dikompres)
+//   zero    semua 0x00 (sangat mudah dikompres)
+//   text    teks ASCII berulang (mudah dikompres)
+//   repeat  1 MiB random yang sama diulang-ulang (perilaku lama, bisa di-dedup)
+func newPayload(pattern string) (payload, error) {
+  switch pattern {
+  case "", "random":
+    var seed [8]byte
+    if _, err := rand.Read(seed[:]); err != nil { return nil, err }
+    return newRandomPayload(binary.LittleEndian.Uint64(seed[:])), nil
+  case "zero":
+    return zeroPayload{}, nil
+  case "text":
+    return &textPayload{}, nil
+  case "repeat":
+    return repeatPayload{}, nil
+  }
+  return nil, fmt.Errorf("unknown pattern %q (random|zero|text|repeat)", pattern)
+}
+
+// randomPayload: xoshiro256**, cukup cepat untuk multi-Gbps per core.
+type randomPayload struct{ s [4]uint64 }
+
+func newRandomPayload(seed uint64) *randomPayload {
+  g := &randomPayload{}
+  for i := range g.s { // splitmix64 untuk mengisi state
+    seed += 0x9e3779b97f4a7c15
+    z := seed
+    z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+    z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+    g.s[i] = z ^ (z >> 31)
+  }
+  return g
+}
+
+func rotl(x uint64, k uint) uint64 { return (x << k) | (x >> (64 - k)) }
+
+func (g *randomPayload) next() uint64 {
+  s := &g.s
+  out := rotl(s[1]*5, 7) * 9
+  t := s[1] << 17
+  s[2] ^= s[0]
+  s[3] ^= s[1]
+  s[1] ^= s[2]
+  s[0] ^= s[3]
+  s[2] ^= t
+  s[3] = rotl(s[3], 45)
+  return out
+}
+
+func (g *randomPayload) fill(p []byte) {
+  for len(p) >= 8 {
+    binary.LittleEndian.PutUint64(p, g.next())
+    p = p[8:]
+  }
+  if len(p) > 0 {
+    var tail [8]byte
+    binary.LittleEndian.PutUint64(tail[:], g.next())
+    copy(p, tail[:])
+  }
+}
+
+type zeroPayload struct{}
+
+func (zeroPayload) fill(p []byte) { clear(p) }
+
+var textLine = []byte("Jinom Speedtest compressible payload 0123456789 abcdefghijklmnopqrstuvwxyz\n")
+
+type textPayload struct{ off int }
+
+func (t *textPayload) fill(p []byte) {
+  for len(p) > 0 {
+    n := copy(p, textLine[t.off:])
+    t.off = (t.off + n) % len(textLine)
+    p = p[n:]
+  }
+}
+
+type repeatPayload struct{}
+
+func (repeatPayload) fill(p []byte) {
+  for len(p) > 0 { p = p[copy(p, chunk):] }
+}
@@ -0,0 +1,230 @@
+package main
+
+import (
+  "encoding/json"
+  "log"
+  "net/http"
+  "os"
+  "path/filepath"
+  "strconv"
+  "sync"
+  "time"
+)
+
+// Budget egress per node (untuk POP di transit metered) + kuota harian per client IP.
+// Counter disimpan ke QUOTA_STATE_FILE supaya tidak reset saat restart. Download yang
+// menabrak budget dipotong di tengah jalan (byte dipesan sebelum ditulis); kalau budget sudah
+// habis, tes baru ditolak.
+//   EGRESS_BUDGET_HOUR_GB / _DAY_GB / _MONTH_GB   0 = tanpa batas (jendela UTC kalender)
+//   CLIENT_DAILY_MB                               0 = tanpa batas
+//   QUOTA_STATE_FILE (default /data/quota-state.json, volume di image Docker), QUOTA_FLUSH_SEC (default 30)
+
+var quotaPeriods = [3]string{"hour", "day", "month"}
+
+type quotaWindow struct {
+  Key  string `json:"key"` // "2006-01-02T15" | "2006-01-02" | "2006-01" (UTC)
+  Used int64  `json:"usedBytes"`
+}
+
+// quotaState: isi file state.
+type quotaState struct {
+  Windows   [3]quotaWindow   `json:"windows"`
+  ClientDay string           `json:"clientDay"`
+  Clients   map[string]int64 `json:"clients"`
+}
+
+type egressQuota struct {
+  enabled     bool
+  limits      [3]int64 // byte per jam/hari/bulan, 0 = tanpa batas
+  clientLimit int64
+  file        string
+
+  mu    sync.Mutex
+  st    quotaState
+  dirty bool
+}
+
+var quota = &egressQuota{}
+
+const defaultQuotaStateFile = "/data/quota-state.json"
+
+func loadEgressQuota() *egressQuota {
+  q := &egressQuota{
+    limits: [3]int64{
+      int64(getenvInt("EGRESS_BUDGET_HOUR_GB", 0)) * 1e9,
+      int64(getenvInt("EGRESS_BUDGET_DAY_GB", 0)) * 1e9,
+      int64(getenvInt("EGRESS_BUDGET_MONTH_GB", 0)) * 1e9,
+    },
+    clientLimit: int64(getenvInt("CLIENT_DAILY_MB", 0)) << 20,
+    file:        getenv("QUOTA_STATE_FILE", defaultQuotaStateFile),
+    st:          quotaState{Clients: map[string]int64{}},
+  }
+  for _, l := range q.limits { q.enabled = q.enabled || l > 0 }
+  q.enabled = q.enabled || q.clientLimit > 0
+  if !q.enabled { return q }
+
+  if b, err := os.ReadFile(q.file); err == nil {
+    if err := json.Unmarshal(b, &q.st); err != nil { log.Printf("quota state %s ignored: %v", q.file, err) }
+    if q.st.Clients == nil { q.st.Clients = map[string]int64{} }
+  } else if !os.IsNotExist(err) {
+    log.Printf("quota state: %v", err)
+  }
+  if _, err := os.Stat(filepath.Dir(q.file)); err != nil {
+    log.Printf("quota state: %v; counters will reset on restart (set QUOTA_STATE_FILE)", err)
+  }
+  q.roll(time.Now())
+  return q
+}
+
+func periodKeys(t time.Time) [3]string {
+  t = t.UTC()
+  return [3]string{t.Format("2006-01-02T15"), t.Format("2006-01-02"), t.Format("2006-01")}
+}
+
+// periodEnd: awal jendela berikutnya (untuk resetAt & Retry-After).
+func periodEnd(i int, t time.Time) time.Time {
+  t = t.UTC()
+  switch i {
+  case 0:
+    return t.Truncate(time.Hour).Add(time.Hour)
+  case 1:
+    return time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, time.UTC)
+  }
+  return time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, time.UTC)
+}
+
+// roll mereset jendela yang sudah lewat. Caller pegang q.mu (atau belum dibagi).
+func (q *egressQuota) roll(now time.Time) {
+  keys := periodKeys(now)
+  for i, k := range keys {
+    if q.st.Windows[i].Key != k { q.st.Windows[i] = quotaWindow{Key: k} }
+  }
+  if q.st.ClientDay != keys[1] {
+    q.st.ClientDay, q.st.Clients = keys[1], map[string]int64{}
+  }
+}
+
+// remaining: sisa byte untuk ip (-1 = tanpa batas) dan jendela node yang paling sempit
+// (-1 kalau yang membatasi kuota client). Caller pegang q.mu.
+func (q *egressQuota) remaining(ip string) (rem int64, window int) {
+  rem, window = -1, -1
+  for i, l := range q.limits {
+    if l <= 0 { continue }
+    if left := max(0, l-q.st.Windows[i].Used); rem < 0 || left < rem { rem, window = left, i }
+  }
+  if q.clientLimit > 0 {
+    if left := max(0, q.clientLimit-q.st.Clients[ip]); rem < 0 || left < rem { rem, window = left, -1 }
+  }
+  return rem, window
+}
+
+// admitDownload: 0 byte tersisa → tolak (status + Retry-After ke reset jendela),
+// selain itu kembalikan sisa byte (-1 = tanpa batas) untuk memotong bytes=.
+func (q *egressQuota) admitDownload(w http.ResponseWriter, ip string) (rem int64, ok bool) {
+  return q.admit(w, ip, 1)
+}
+
+// admitFile: Content-Length sudah dijanjikan dan tidak bisa dipotong, jadi seluruh n byte
+// harus muat di sisa kuota; kalau tidak, tolak sebelum header terkirim.
+func (q *egressQuota) admitFile(w http.ResponseWriter, ip string, n int64) bool {
+  _, ok := q.admit(w, ip, max(n, 1))
+  return ok
+}
+
+func (q *egressQuota) admit(w http.ResponseWriter, ip string, need int64) (rem int64, ok bool) {
+  if !q.enabled { return -1, true }
+  now := time.Now()
+  q.mu.Lock()
+  q.roll(now)
+  rem, window := q.remaining(ip)
+  q.mu.Unlock()
+  if rem < 0 || rem >= need { return rem, true }
+
+  metrics.reject("quota")
+  if window < 0 {
+    w.Header().Set("Retry-After", strconv.Itoa(int(periodEnd(1, now).Sub(now).Seconds())+1))
+    http.Error(w, "daily quota for this client exhausted", http.StatusTooManyRequests)
+  } else {
+    // budget node habis: klien sebaiknya pindah node
+    w.Header().Set("Retry-After", strconv.Itoa(int(periodEnd(window, now).Sub(now).Seconds())+1))
+    http.Error(w, "node egress budget exhausted ("+quotaPeriods[window]+")", http.StatusServiceUnavailable)
+  }
+  return 0, false
+}
+
+// left: sisa byte untuk ip (-1 = tanpa batas), untuk jalur non-HTTP (raw TCP).
+func (q *egressQuota) left(ip string) int64 {
+  if !q.enabled { return -1 }
+  q.mu.Lock()
+  defer q.mu.Unlock()
+  q.roll(time.Now())
+  rem, _ := q.remaining(ip)
+  return rem
+}
+
+// add memesan n byte egress SEBELUM ditulis dan mengembalikan jumlah yang boleh dikirim.
+// Hasil < n berarti budget/kuota habis: tulis sebanyak itu lalu hentikan stream. Karena
+// dipesan di bawah lock, stream paralel tidak bisa bersama-sama melewati batas.
+func (q *egressQuota) add(ip string, n int) int {
+  if !q.enabled || n <= 0 { return n }
+  q.mu.Lock()
+  defer q.mu.Unlock()
+  q.roll(time.Now())
+  if rem, _ := q.remaining(ip); rem >= 0 && int64(n) > rem { n = int(rem) }
+  if n == 0 { return 0 }
+  for i := range q.st.Windows { q.st.Windows[i].Used += int64(n) }
+  if q.clientLimit > 0 { q.st.Clients[ip] += int64(n) }
+  q.dirty = true
+  return n
+}
+
+// nodeExhausted: salah satu budget node habis (load dilaporkan 100).
+func (q *egressQuota) nodeExhausted() bool {
+  if !q.enabled { return false }
+  q.mu.Lock()
+  defer q.mu.Unlock()
+  q.roll(time.Now())
+  for i, l := range q.limits {
+    if l > 0 && q.st.Windows[i].Used >= l { return true }
+  }
+  return false
+}
+
+// snapshot untuk /api/v1/config dan heartbeat (nil kalau kuota tidak aktif).
+func (q *egressQuota) snapshot() map[string]any {
+  if !q.enabled { return nil }
+  now := time.Now()
+  q.mu.Lock()
+  defer q.mu.Unlock()
+  q.roll(now)
+  out := map[string]any{"clientDailyBytes": q.clientLimit}
+  exhausted := false
+  for i, l := range q.limits {
+    if l <= 0 { continue }
+    used := q.st.Windows[i].Used
+    exhausted = exhausted || used >= l
+    out[quotaPeriods[i]] = map[string]any{
+      "limitBytes": l, "usedBytes": used, "remainingBytes": max(0, l-used),
+      "usedPct": round1(100 * float64(used) / float64(l)), "resetAt": periodEnd(i, now),
+    }
+  }
+  out["exhausted"] = exhausted
+  return out
+}
+
+func (q *egressQuota) save() {
+  if !q.enabled { return }
+  q.mu.Lock()
+  if !q.dirty { q.mu.Unlock(); return }
+  b, err := json.Marshal(q.st)
+  q.dirty = false
+  q.mu.Unlock()
+  if err != nil { return }
+  tmp := q.file + ".tmp"
+  if err := os.WriteFile(tmp, b, 0o644); err != nil { log.Printf("quota save: %v", err); return }
+  if err := os.Rename(tmp, q.file); err != nil { log.Printf("quota save: %v", err) }
+}
+
+func (q *egressQuota) flusher(every time.Duration) {
+  for range time.Tick(every) { q.save() }
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+  "net/http"
+  "net/http/httptest"
+  "path/filepath"
+  "sync"
+  "testing"
+  "time"
+)
+
+func TestQuotaRoll(t *testing.T) {
+  now := time.Date(2026, 3, 31, 23, 30, 0, 0, time.UTC)
+  q := &egressQuota{st: quotaState{Clients: map[string]int64{}}}
+  q.roll(now)
+  q.st.Windows[0].Used, q.st.Windows[1].Used, q.st.Windows[2].Used = 1, 2, 3
+  q.st.Clients["10.0.0.1"] = 4
+
+  q.roll(now.Add(10 * time.Minute)) // jendela yang sama
+  if q.st.Windows[0].Used != 1 || q.st.Clients["10.0.0.1"] != 4 { t.Fatalf("same window reset: %+v", q.st) }
+
+  q.roll(now.Add(time.Hour)) // jam, hari dan bulan baru
+  for i, w := range q.st.Windows {
+    if w.Used != 0 { t.Errorf("%s window not reset: %+v", quotaPeriods[i], w) }
+  }
+  if q.st.ClientDay != "2026-04-01" || len(q.st.Clients) != 0 { t.Errorf("client day not reset: %q %v", q.st.ClientDay, q.st.Clients) }
+  if got := periodEnd(2, now); !got.Equal(time.Date(2026, 4, 1, 0, 0, 0, 0, time.UTC)) { t.Errorf("periodEnd(month) = %v", got) }
+}
+
+func TestQuotaRemaining(t *testing.T) {
+  q := &egressQuota{enabled: true, limits: [3]int64{0, 100, 1000}, clientLimit: 50, st: quotaState{Clients: map[string]int64{}}}
+  q.roll(time.Now())
+  if rem, w := q.remaining("a"); rem != 50 || w != -1 { t.Errorf("remaining = %d/%d, want 50 (client)", rem, w) }
+  q.st.Windows[1].Used = 80
+  if rem, w := q.remaining("a"); rem != 20 || w != 1 { t.Errorf("remaining = %d/%d, want 20 (day)", rem, w) }
+  q.st.Windows[1].Used = 150
+  if rem, _ := q.remaining("a"); rem != 0 { t.Errorf("remaining over budget = %d, want 0", rem) }
+
+  q = &egressQuota{st: quotaState{Clients: map[string]int64{}}}
+  if rem, _ := q.remaining("a"); rem != -1 { t.Errorf("unlimited remaining = %d, want -1", rem) }
+}
+
+func TestQuotaAddReserves(t *testing.T) {
+  const limit = 5 << 20
+  q := &egressQuota{enabled: true, clientLimit: limit, st: quotaState{Clients: map[string]int64{}}}
+
+  // stream paralel tidak boleh bersama-sama melewati kuota
+  var wg sync.WaitGroup
+  var mu sync.Mutex
+  var total int
+  for i := 0; i < 8; i++ {
+    wg.Add(1)
+    go func() {
+      defer wg.Done()
+      for {
+        n := q.add("a", 1<<20)
+        mu.Lock()
+        total += n
+        mu.Unlock()
+        if n < 1<<20 { return }
+      }
+    }()
+  }
+  wg.Wait()
+  if total != limit { t.Errorf("sent %d bytes in parallel, want exactly %d", total, limit) }
+  if q.st.Clients["a"] != limit { t.Errorf("charged %d, want %d", q.st.Clients["a"], limit) }
+
+  q.st.Clients["b"] = limit - 100
+  if n := q.add("b", 1<<20); n != 100 { t.Errorf("partial add = %d, want 100", n) }
+  if n := q.add("b", 1<<20); n != 0 { t.Errorf("add after exhausted = %d, want 0", n) }
+  if n := (&egressQuota{}).add("b", 42); n != 42 { t.Errorf("disabled add = %d, want 42", n) }
+}
+
+func TestQuotaAdmitFile(t *testing.T) {
+  q := &egressQuota{enabled: true, clientLimit: 1000, st: quotaState{Clients: map[string]int64{}}}
+  q.roll(time.Now())
+  q.st.Clients["a"] = 400
+
+  w := httptest.NewRecorder()
+  if !q.admitFile(w, "a", 600) { t.Fatalf("600 of 600 left rejected: %d", w.Code) }
+  w = httptest.NewRecorder()
+  if q.admitFile(w, "a", 601) { t.Fatal("601 of 600 left admitted") }
+  if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") == "" {
+    t.Errorf("rejection = %d Retry-After %q, want 429 with Retry-After", w.Code, w.Header().Get("Retry-After"))
+  }
+
+  q.limits[1], q.st.Windows[1].Used = 100, 100 // budget node harian habis
+  w = httptest.NewRecorder()
+  if _, ok := q.admitDownload(w, "b"); ok || w.Code != http.StatusServiceUnavailable { t.Errorf("node budget exhausted: ok=%v code=%d, want 503", ok, w.Code) }
+}
+
+func TestQuotaPersist(t *testing.T) {
+  file := filepath.Join(t.TempDir(), "quota.json")
+  t.Setenv("CLIENT_DAILY_MB", "5")
+  t.Setenv("EGRESS_BUDGET_DAY_GB", "1")
+  t.Setenv("QUOTA_STATE_FILE", file)
+
+  q := loadEgressQuota()
+  if !q.enabled || q.clientLimit != 5<<20 || q.limits[1] != 1e9 { t.Fatalf("loadEgressQuota = %+v", q) }
+  q.add("10.0.0.1", 1234)
+  q.save()
+
+  q = loadEgressQuota()
+  if got := q.st.Clients["10.0.0.1"]; got != 1234 { t.Errorf("client usage after reload = %d, want 1234", got) }
+  if got := q.st.Windows[1].Used; got != 1234 { t.Errorf("day usage after reload = %d, want 1234", got) }
+}
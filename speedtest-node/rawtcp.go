@@ -0,0 +1,318 @@
+package main
+
+import (
+  "bufio"
+  "context"
+  "encoding/json"
+  "errors"
+  "io"
+  "log"
+  "net"
+  "slices"
+  "strings"
+  "sync"
+  "sync/atomic"
+  "time"
+)
+
+// Listener TCP mentah (RAW_TCP_ADDR) ala iperf: tanpa framing HTTP, untuk link 10G dan
+// klien Linux/router. Satu port untuk kontrol dan data; baris pertama menentukan peran.
+//
+//   kontrol  klien: {"direction":"download|upload|bidir","durationSec":10,"streams":4,
+//                    "reverse":false,"intervalMs":1000,"pattern":"random","cc":"bbr"}\n
+//            node:  {"type":"ready","id":"<token>",...}\n
+//   data     klien membuka `streams` koneksi, masing-masing diawali "DATA <token>\n".
+//            download = node mengirim, upload = node membaca, bidir = keduanya di tiap koneksi;
+//            reverse=true membalik download/upload.
+//
+// Setelah semua stream tersambung node mengirim {"type":"start"}, lalu {"type":"interval"}
+// tiap intervalMs (byte/Mbps dan TCP_INFO per stream, dihitung di node) dan {"type":"result"}
+// di akhir. Menutup koneksi kontrol menghentikan tes. Semua pesan kontrol JSON satu baris.
+
+const rawJoinTimeout = 10 * time.Second
+
+type rawRequest struct {
+  Direction   string `json:"direction"`
+  DurationSec int64  `json:"durationSec"`
+  Streams     int    `json:"streams"`
+  Reverse     bool   `json:"reverse"`
+  IntervalMs  int    `json:"intervalMs"`
+  Pattern     string `json:"pattern"`
+  CC          string `json:"cc"`
+}
+
+type rawStream struct {
+  id         int
+  conn       net.Conn
+  rd         io.Reader // bufio dari handshake (bisa sudah berisi data upload)
+  sent, recv atomic.Int64
+  lastSent   int64 // hanya dipakai reporter
+  lastRecv   int64
+}
+
+type rawStreamStat struct {
+  ID            int      `json:"id"`
+  SentBytes     int64    `json:"sentBytes"`
+  ReceivedBytes int64    `json:"receivedBytes"`
+  SentMbps      float64  `json:"sentMbps"`
+  ReceivedMbps  float64  `json:"receivedMbps"`
+  TCP           *tcpInfo `json:"tcp,omitempty"`
+}
+
+type rawTest struct {
+  id       string
+  ip       string
+  send     bool // node mengirim
+  recv     bool // node membaca
+  n        int
+  dur      time.Duration
+  interval time.Duration
+  pattern  string
+  cc       string
+
+  mu      sync.Mutex
+  streams []*rawStream
+  joined  chan struct{} // ditutup saat semua stream tersambung
+  ctx     context.Context
+  cancel  context.CancelFunc
+}
+
+type rawTCPServer struct {
+  ln    net.Listener
+  mu    sync.Mutex
+  tests map[string]*rawTest
+  wg    sync.WaitGroup
+}
+
+func startRawTCP(addr string) (*rawTCPServer, error) {
+  ln, err := net.Listen("tcp", addr)
+  if err != nil { return nil, err }
+  s := &rawTCPServer{ln: ln, tests: map[string]*rawTest{}}
+  go s.serve()
+  return s, nil
+}
+
+func (s *rawTCPServer) serve() {
+  for {
+    c, err := s.ln.Accept()
+    if errors.Is(err, net.ErrClosed) { return }
+    if err != nil { log.Printf("raw tcp: %v", err); time.Sleep(100 * time.Millisecond); continue }
+    go s.handle(c)
+  }
+}
+
+// Shutdown: berhenti menerima koneksi, tes yang masih jalan ditunggu sampai ctx habis.
+func (s *rawTCPServer) Shutdown(ctx context.Context) error {
+  err := s.ln.Close()
+  done := make(chan struct{})
+  go func() { s.wg.Wait(); close(done) }()
+  select {
+  case <-done:
+  case <-ctx.Done():
+    s.mu.Lock()
+    for _, t := range s.tests { t.cancel() }
+    s.mu.Unlock()
+  }
+  return err
+}
+
+func (s *rawTCPServer) handle(c net.Conn) {
+  _ = c.SetReadDeadline(time.Now().Add(rawJoinTimeout))
+  br := bufio.NewReaderSize(c, 4096)
+  line, err := br.ReadSlice('\n')
+  if err != nil { _ = c.Close(); return }
+  _ = c.SetReadDeadline(time.Time{})
+  if tok, ok := strings.CutPrefix(strings.TrimSpace(string(line)), "DATA "); ok {
+    s.join(c, br, tok)
+    return
+  }
+  defer c.Close()
+  var req rawRequest
+  if err := json.Unmarshal(line, &req); err != nil { rawReply(c, rawError("bad request: "+err.Error())); return }
+  s.control(c, br, req)
+}
+
+func rawError(msg string) map[string]any { return map[string]any{"type": "error", "error": msg} }
+
+func rawReply(c net.Conn, v any) error {
+  b, _ := json.Marshal(v)
+  _ = c.SetWriteDeadline(time.Now().Add(5 * time.Second))
+  _, err := c.Write(append(b, '\n'))
+  return err
+}
+
+// newRawTest memvalidasi permintaan kontrol dan menerapkan limit node (streams, durasi,
+// interval 100ms..10s, default 1s).
+func newRawTest(req rawRequest, ip string) (*rawTest, error) {
+  t := &rawTest{id: newSessionID(), ip: ip, joined: make(chan struct{}), pattern: req.Pattern, cc: req.CC}
+  switch req.Direction {
+  case "", "download": t.send = true
+  case "upload": t.recv = true
+  case "bidir": t.send, t.recv = true, true
+  default:
+    return nil, errors.New("direction must be download, upload or bidir")
+  }
+  if req.Reverse && t.send != t.recv { t.send, t.recv = t.recv, t.send }
+  if _, err := newPayload(req.Pattern); err != nil { return nil, err }
+  if req.CC != "" && !slices.Contains(ccAlgos, req.CC) { return nil, errors.New("congestion control not allowed: " + req.CC) }
+  t.n = min(max(req.Streams, 1), limits.Load().MaxStreams)
+  t.dur = clampDuration(req.DurationSec)
+  t.interval = time.Duration(min(max(req.IntervalMs, 100), 10000)) * time.Millisecond
+  if req.IntervalMs == 0 { t.interval = time.Second }
+  return t, nil
+}
+
+func (s *rawTCPServer) control(c net.Conn, br *bufio.Reader, req rawRequest) {
+  ip, _, _ := net.SplitHostPort(c.RemoteAddr().String())
+  t, err := newRawTest(req, ip)
+  if err != nil { rawReply(c, rawError(err.Error())); return }
+
+  // aturan sama dengan HTTP: drain/maintenance, kuota egress, slot stream per client
+  if refusingTests() { metrics.reject(nodeState()); rawReply(c, rawError(nodeState())); return }
+  if t.send && quota.left(ip) == 0 { metrics.reject("quota"); rawReply(c, rawError("egress quota exhausted")); return }
+  for i := range t.n {
+    if !admit.acquire(ip) {
+      for range i { admit.release(ip) }
+      metrics.reject("streams")
+      rawReply(c, rawError("too many streams"))
+      return
+    }
+  }
+  defer func() { for range t.n { admit.release(ip) } }()
+
+  t.ctx, t.cancel = context.WithCancel(context.Background())
+  defer t.cancel()
+  s.wg.Add(1)
+  defer s.wg.Done()
+  s.mu.Lock()
+  s.tests[t.id] = t
+  s.mu.Unlock()
+  defer func() {
+    s.mu.Lock()
+    delete(s.tests, t.id)
+    s.mu.Unlock()
+    t.mu.Lock()
+    t.cancel()
+    for _, st := range t.streams { _ = st.conn.Close() }
+    t.mu.Unlock()
+  }()
+
+  dir := "download"
+  if t.recv { dir = "upload" }
+  if t.send && t.recv { dir = "bidir" }
+  if rawReply(c, map[string]any{"type": "ready", "id": t.id, "direction": dir, "streams": t.n,
+    "durationSec": t.dur.Seconds(), "intervalMs": t.interval.Milliseconds()}) != nil { return }
+
+  // koneksi kontrol ditutup klien = batal
+  go func() {
+    _, _ = io.Copy(io.Discard, br)
+    t.cancel()
+  }()
+
+  select {
+  case <-t.joined:
+  case <-t.ctx.Done():
+    return
+  case <-time.After(rawJoinTimeout):
+    rawReply(c, rawError("timeout waiting for data streams"))
+    return
+  }
+  t.run(c)
+}
+
+// join: koneksi data dengan token dari "ready".
+func (s *rawTCPServer) join(c net.Conn, rd io.Reader, tok string) {
+  s.mu.Lock()
+  t := s.tests[tok]
+  s.mu.Unlock()
+  if t == nil { _ = c.Close(); return }
+  t.mu.Lock()
+  defer t.mu.Unlock()
+  if len(t.streams) >= t.n || t.ctx.Err() != nil { _ = c.Close(); return }
+  if tc := tcpConnOf(c); tc != nil && t.cc != "" { _ = setCC(tc, t.cc) }
+  t.streams = append(t.streams, &rawStream{id: len(t.streams), conn: c, rd: rd})
+  if len(t.streams) == t.n { close(t.joined) }
+}
+
+func (t *rawTest) run(ctrl net.Conn) {
+  if rawReply(ctrl, map[string]any{"type": "start"}) != nil { return }
+  start := time.Now()
+  end := start.Add(t.dur)
+  var wg sync.WaitGroup
+  for _, st := range t.streams {
+    _ = st.conn.SetDeadline(end) // write/read yang menggantung lepas saat waktu habis
+    stop := context.AfterFunc(t.ctx, func() { _ = st.conn.SetDeadline(time.Now()) })
+    defer stop()
+    if t.send { wg.Add(1); go func() { defer wg.Done(); t.sendLoop(st) }() }
+    if t.recv { wg.Add(1); go func() { defer wg.Done(); t.recvLoop(st) }() }
+  }
+  done := make(chan struct{})
+  go func() { wg.Wait(); close(done) }()
+
+  tick := time.NewTicker(t.interval)
+  defer tick.Stop()
+  last := start
+loop:
+  for {
+    select {
+    case <-done:
+      break loop
+    case now := <-tick.C:
+      msg := map[string]any{"type": "interval", "t": now.Sub(start).Seconds()}
+      msg["streams"], msg["sentMbps"], msg["receivedMbps"] = t.stats(now.Sub(last), true)
+      last = now
+      if rawReply(ctrl, msg) != nil { t.cancel() }
+    }
+  }
+  el := time.Since(start)
+  msg := map[string]any{"type": "result", "durationMs": el.Milliseconds()}
+  var sent, recv int64
+  for _, st := range t.streams { sent += st.sent.Load(); recv += st.recv.Load() }
+  msg["sentBytes"], msg["receivedBytes"] = sent, recv
+  msg["streams"], msg["sentMbps"], msg["receivedMbps"] = t.stats(el, false)
+  _ = rawReply(ctrl, msg)
+}
+
+// stats: per stream + total Mbps; delta=true untuk interval (sejak laporan sebelumnya).
+func (t *rawTest) stats(d time.Duration, delta bool) ([]rawStreamStat, float64, float64) {
+  out := make([]rawStreamStat, len(t.streams))
+  var ts, tr float64
+  for i, st := range t.streams {
+    sent, recv := st.sent.Load(), st.recv.Load()
+    ds, dr := sent, recv
+    if delta { ds, dr = sent-st.lastSent, recv-st.lastRecv; st.lastSent, st.lastRecv = sent, recv }
+    out[i] = rawStreamStat{ID: st.id, SentBytes: ds, ReceivedBytes: dr, SentMbps: mbps(ds, d), ReceivedMbps: mbps(dr, d), TCP: connTCPInfo(st.conn)}
+    ts += out[i].SentMbps
+    tr += out[i].ReceivedMbps
+  }
+  return out, ts, tr
+}
+
+func (t *rawTest) sendLoop(st *rawStream) {
+  metrics.activeDown.Add(1)
+  defer metrics.activeDown.Add(-1)
+  gen, _ := newPayload(t.pattern) // sudah divalidasi di handshake
+  bufp := chunkPool.Get().(*[]byte)
+  defer chunkPool.Put(bufp)
+  buf := *bufp
+  for t.ctx.Err() == nil {
+    gen.fill(buf)
+    allowed := quota.add(t.ip, len(buf))
+    n, err := st.conn.Write(buf[:allowed])
+    st.sent.Add(int64(n))
+    metrics.bytesSent.Add(int64(n))
+    if err != nil || allowed < len(buf) { return }
+  }
+}
+
+func (t *rawTest) recvLoop(st *rawStream) {
+  metrics.activeUp.Add(1)
+  defer metrics.activeUp.Add(-1)
+  buf := make([]byte, 1<<20)
+  for {
+    n, err := st.rd.Read(buf)
+    st.recv.Add(int64(n))
+    metrics.bytesReceived.Add(int64(n))
+    if err != nil { return }
+  }
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+  "bufio"
+  "encoding/json"
+  "io"
+  "net"
+  "testing"
+  "time"
+)
+
+// setTestLimits memasang limit node untuk satu tes dan mengembalikan yang lama sesudahnya.
+func setTestLimits(t *testing.T, l limitsConfig) {
+  t.Helper()
+  old := limits.Load()
+  limits.Store(&l)
+  t.Cleanup(func() { limits.Store(old) })
+}
+
+var testLimits = limitsConfig{MaxStreams: 4, MaxNodeStreams: 16, MaxDurationSec: 1, MaxStreamBytes: 1 << 30, RetryAfterSec: 1}
+
+func TestNewRawTest(t *testing.T) {
+  setTestLimits(t, testLimits)
+  tests := []struct {
+    name       string
+    req        rawRequest
+    send, recv bool
+    n          int
+    interval   time.Duration
+  }{
+    {"defaults", rawRequest{}, true, false, 1, time.Second},
+    {"upload", rawRequest{Direction: "upload", Streams: 2}, false, true, 2, time.Second},
+    {"reverse download", rawRequest{Direction: "download", Reverse: true}, false, true, 1, time.Second},
+    {"bidir ignores reverse", rawRequest{Direction: "bidir", Reverse: true}, true, true, 1, time.Second},
+    {"streams clamped", rawRequest{Streams: 99}, true, false, 4, time.Second},
+    {"interval", rawRequest{IntervalMs: 500}, true, false, 1, 500 * time.Millisecond},
+    {"interval too small", rawRequest{IntervalMs: 10}, true, false, 1, 100 * time.Millisecond},
+    {"interval negative", rawRequest{IntervalMs: -5}, true, false, 1, 100 * time.Millisecond},
+    {"interval too large", rawRequest{IntervalMs: 60000}, true, false, 1, 10 * time.Second},
+  }
+  for _, tt := range tests {
+    t.Run(tt.name, func(t *testing.T) {
+      rt, err := newRawTest(tt.req, "10.0.0.1")
+      if err != nil { t.Fatal(err) }
+      if rt.send != tt.send || rt.recv != tt.recv || rt.n != tt.n || rt.interval != tt.interval {
+        t.Errorf("got send=%v recv=%v n=%d interval=%s", rt.send, rt.recv, rt.n, rt.interval)
+      }
+      if rt.dur != time.Second { t.Errorf("dur = %s, want clamp to MAX_DURATION_SEC", rt.dur) }
+    })
+  }
+  for _, req := range []rawRequest{{Direction: "sideways"}, {Pattern: "bogus"}, {CC: "not-a-cc"}} {
+    if _, err := newRawTest(req, "10.0.0.1"); err == nil { t.Errorf("%+v: no error", req) }
+  }
+}
+
+type rawTestClient struct {
+  t  *testing.T
+  c  net.Conn
+  rd *bufio.Reader
+}
+
+func dialRaw(t *testing.T, addr string, first string) *rawTestClient {
+  t.Helper()
+  c, err := net.Dial("tcp", addr)
+  if err != nil { t.Fatal(err) }
+  t.Cleanup(func() { c.Close() })
+  _ = c.SetDeadline(time.Now().Add(10 * time.Second))
+  if _, err := io.WriteString(c, first+"\n"); err != nil { t.Fatal(err) }
+  return &rawTestClient{t: t, c: c, rd: bufio.NewReader(c)}
+}
+
+func (rc *rawTestClient) next() map[string]any {
+  rc.t.Helper()
+  line, err := rc.rd.ReadBytes('\n')
+  if err != nil { rc.t.Fatalf("reading control message: %v", err) }
+  var m map[string]any
+  if err := json.Unmarshal(line, &m); err != nil { rc.t.Fatalf("bad control message %q: %v", line, err) }
+  return m
+}
+
+func startTestRawTCP(t *testing.T) *rawTCPServer {
+  t.Helper()
+  s, err := startRawTCP("127.0.0.1:0")
+  if err != nil { t.Fatal(err) }
+  t.Cleanup(func() { s.ln.Close() })
+  return s
+}
+
+func TestRawTCPHandshake(t *testing.T) {
+  setTestLimits(t, testLimits)
+  s := startTestRawTCP(t)
+  addr := s.ln.Addr().String()
+
+  for _, dir := range []string{"download", "upload"} {
+    t.Run(dir, func(t *testing.T) {
+      ctrl := dialRaw(t, addr, `{"direction":"`+dir+`","streams":2,"durationSec":1,"intervalMs":200}`)
+      ready := ctrl.next()
+      if ready["type"] != "ready" || ready["direction"] != dir || ready["streams"] != 2.0 || ready["intervalMs"] != 200.0 {
+        t.Fatalf("ready = %v", ready)
+      }
+      for range 2 {
+        d := dialRaw(t, addr, "DATA "+ready["id"].(string))
+        if dir == "download" {
+          go io.Copy(io.Discard, d.c)
+        } else {
+          go func() {
+            buf := make([]byte, 64<<10)
+            for { if _, err := d.c.Write(buf); err != nil { return } }
+          }()
+        }
+      }
+      if m := ctrl.next(); m["type"] != "start" { t.Fatalf("after join: %v", m) }
+      intervals := 0
+      for {
+        m := ctrl.next()
+        if m["type"] == "interval" {
+          intervals++
+          if len(m["streams"].([]any)) != 2 { t.Errorf("interval streams = %v", m["streams"]) }
+          continue
+        }
+        if m["type"] != "result" { t.Fatalf("unexpected message %v", m) }
+        key := map[string]string{"download": "sentBytes", "upload": "receivedBytes"}[dir]
+        if b, _ := m[key].(float64); b <= 0 { t.Errorf("result %s = %v", key, m[key]) }
+        break
+      }
+      if intervals < 3 { t.Errorf("got %d interval reports in 1s at 200ms, want >= 3", intervals) }
+    })
+  }
+}
+
+func TestRawTCPHandshakeErrors(t *testing.T) {
+  setTestLimits(t, testLimits)
+  s := startTestRawTCP(t)
+  addr := s.ln.Addr().String()
+
+  for _, first := range []string{`not json`, `{"direction":"sideways"}`} {
+    if m := dialRaw(t, addr, first).next(); m["type"] != "error" { t.Errorf("%s: got %v, want error", first, m) }
+  }
+  // token tidak dikenal: koneksi data langsung ditutup
+  d := dialRaw(t, addr, "DATA nope")
+  if _, err := d.rd.ReadByte(); err != io.EOF { t.Errorf("unknown token: read err = %v, want EOF", err) }
+}
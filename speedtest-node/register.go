@@ -0,0 +1,117 @@
+package main
+
+import (
+  "bytes"
+  "encoding/json"
+  "errors"
+  "fmt"
+  "log"
+  "net/http"
+  "strings"
+  "time"
+)
+
+// Self-registration ke speedtest-directory: register sekali saat start, lalu
+// heartbeat periodik berisi statistik live. Directory menandai node DOWN kalau
+// heartbeat berhenti, jadi node di belakang NAT pun tetap terpantau.
+
+type registrar struct {
+  dirURL   string
+  token    string
+  every    time.Duration
+  identity map[string]any // id, region, city, url, capabilities
+  client   *http.Client
+  started  time.Time
+}
+
+var errUnknownNode = errors.New("directory does not know this node")
+
+var dirRegistrar *registrar // nil kalau self-registration tidak aktif
+
+// capabilities yang diiklankan ke directory; fitur opsional menambah lewat addCapability.
+var nodeCaps = []string{"latency", "download", "upload", "sessions", "metrics"}
+
+func addCapability(c ...string) { nodeCaps = append(nodeCaps, c...) }
+
+func capabilities() []string { return nodeCaps }
+
+func (g *registrar) post(path string, body any) error {
+  b, _ := json.Marshal(body)
+  req, err := http.NewRequest(http.MethodPost, g.dirURL+path, bytes.NewReader(b))
+  if err != nil { return err }
+  req.Header.Set("Content-Type", "application/json")
+  req.Header.Set("Authorization", "Bearer "+g.token)
+  resp, err := g.client.Do(req)
+  if err != nil { return err }
+  defer resp.Body.Close()
+  if resp.StatusCode == http.StatusNotFound { return errUnknownNode }
+  if resp.StatusCode/100 != 2 { return fmt.Errorf("%s: HTTP %d", path, resp.StatusCode) }
+  return nil
+}
+
+func (g *registrar) register() error {
+  return g.post("/api/v1/nodes/register", g.identity)
+}
+
+// stats dikirim tiap heartbeat (disimpan apa adanya oleh directory).
+func (g *registrar) stats() map[string]any {
+  return map[string]any{
+    "load":                  currentLoad().Load,
+    "loadDetail":            currentLoad(),
+    "activeDownloadStreams": metrics.activeDown.Load(),
+    "activeUploadStreams":   metrics.activeUp.Load(),
+    "bytesSent":             metrics.bytesSent.Load(),
+    "bytesReceived":         metrics.bytesReceived.Load(),
+    "sessions":              sessions.count(),
+    "uptimeSec":             int64(time.Since(g.started) / time.Second),
+    "state":                 nodeState(), // "up" | "draining" | "maintenance"
+    "quota":                 quota.snapshot(),
+  }
+}
+
+func (g *registrar) heartbeat() {
+  err := g.post(fmt.Sprintf("/api/v1/nodes/%v/heartbeat", g.identity["id"]), g.stats())
+  if errors.Is(err, errUnknownNode) {
+    // directory kehilangan data (mis. DB di-reset) → register ulang
+    err = g.register()
+  }
+  if err != nil { log.Printf("directory heartbeat failed: %v", err) }
+}
+
+func (g *registrar) run() {
+  // register dengan backoff sampai berhasil
+  for backoff := time.Second; ; {
+    err := g.register()
+    if err == nil { break }
+    log.Printf("directory register failed: %v (retry in %s)", err, backoff)
+    time.Sleep(backoff)
+    if backoff < time.Minute { backoff *= 2 }
+  }
+  log.Printf("registered to directory %s as %v", g.dirURL, g.identity["id"])
+
+  for range time.Tick(g.every) { g.heartbeat() }
+}
+
+// startRegistrar aktif kalau DIRECTORY_URL di-set.
+func startRegistrar(nodeID, region string) {
+  dirURL := strings.TrimRight(getenv("DIRECTORY_URL", ""), "/")
+  if dirURL == "" { return }
+  publicURL := strings.TrimRight(getenv("PUBLIC_URL", ""), "/")
+  if publicURL == "" {
+    log.Printf("DIRECTORY_URL set but PUBLIC_URL empty, self-registration disabled")
+    return
+  }
+  g := &registrar{
+    dirURL: dirURL,
+    token:  getenv("NODE_TOKEN", ""),
+    every:  time.Duration(getenvInt("HEARTBEAT_SEC", 15)) * time.Second,
+    identity: map[string]any{
+      "id": nodeID, "region": region, "city": getenv("CITY", region),
+      "url": publicURL, "capabilities": capabilities(),
+    },
+    client:  &http.Client{Timeout: 5 * time.Second},
+    started: time.Now(),
+  }
+  dirRegistrar = g
+  go g.run()
+}
@@ -0,0 +1,414 @@
+package main
+
+import (
+  "context"
+  "crypto/rand"
+  "encoding/hex"
+  "encoding/json"
+  "errors"
+  "net/http"
+  "strconv"
+  "sync"
+  "time"
+)
+
+// Sesi tes: beberapa stream download/upload paralel yang dihitung di sisi node,
+// supaya ada angka throughput yang otoritatif (bukan hitungan browser).
+
+type streamStat struct {
+  ID        int        `json:"id"`
+  Direction string     `json:"direction"`
+  Bytes     int64      `json:"bytes"`
+  StartedAt time.Time  `json:"startedAt"`
+  EndedAt   *time.Time `json:"endedAt,omitempty"`
+  TCP       *tcpInfo   `json:"tcp,omitempty"` // TCP_INFO saat stream selesai
+}
+
+// meter: byte per detik untuk satu arah, detik ke-0 = stream pertama mulai.
+type meter struct {
+  start   time.Time
+  end     time.Time
+  active  int
+  streams int
+  total   int64
+  buckets []int64
+}
+
+type session struct {
+  ID        string
+  CreatedAt time.Time
+  ClientIP  string
+  ctx       context.Context // dibatalkan kalau sesi di-kill lewat admin API
+  cancel    context.CancelFunc
+  impair    *impairSpec // profil impairment untuk semua stream sesi (nil = tanpa)
+
+  mu       sync.Mutex
+  lastSeen time.Time
+  streams  []*streamStat
+  meters   map[string]*meter           // "download" | "upload"
+  rtts     map[string][]time.Duration // sampel RTT per fase (idle/download/upload)
+}
+
+type sessionStore struct {
+  mu    sync.Mutex
+  m     map[string]*session
+  perIP map[string]int
+  ttl   time.Duration
+  max   int
+  maxIP int // per client IP, supaya satu client tidak menghabiskan max
+}
+
+var sessions = &sessionStore{m: map[string]*session{}, perIP: map[string]int{}, ttl: 10 * time.Minute, max: 1000, maxIP: 10}
+
+var (
+  errSessionsFull   = errors.New("too many sessions")
+  errClientSessions = errors.New("too many sessions for this client")
+)
+
+func newSessionID() string {
+  b := make([]byte, 8)
+  _, _ = rand.Read(b)
+  return hex.EncodeToString(b)
+}
+
+func (s *sessionStore) create(ip string, imp *impairSpec) (*session, error) {
+  s.mu.Lock()
+  defer s.mu.Unlock()
+  if len(s.m) >= s.max { return nil, errSessionsFull }
+  if s.perIP[ip] >= s.maxIP { return nil, errClientSessions }
+  now := time.Now()
+  ss := &session{ID: newSessionID(), CreatedAt: now, ClientIP: ip, impair: imp, lastSeen: now, meters: map[string]*meter{}, rtts: map[string][]time.Duration{}}
+  ss.ctx, ss.cancel = context.WithCancel(context.Background())
+  s.m[ss.ID] = ss
+  s.perIP[ip]++
+  return ss, nil
+}
+
+// remove: caller pegang s.mu.
+func (s *sessionStore) remove(ss *session) {
+  delete(s.m, ss.ID)
+  if s.perIP[ss.ClientIP]--; s.perIP[ss.ClientIP] <= 0 { delete(s.perIP, ss.ClientIP) }
+}
+
+func (s *sessionStore) get(id string) *session {
+  s.mu.Lock()
+  defer s.mu.Unlock()
+  return s.m[id]
+}
+
+func (s *sessionStore) count() int {
+  s.mu.Lock()
+  defer s.mu.Unlock()
+  return len(s.m)
+}
+
+// janitor membuang sesi yang idle lebih lama dari ttl.
+func (s *sessionStore) janitor() {
+  for range time.Tick(time.Minute) {
+    s.mu.Lock()
+    for _, ss := range s.m {
+      if ss.idleSince() > s.ttl {
+        ss.cancel()
+        s.remove(ss)
+      }
+    }
+    s.mu.Unlock()
+  }
+}
+
+// kill membatalkan semua stream sesi dan membuangnya dari store.
+func (s *sessionStore) kill(id string) bool {
+  s.mu.Lock()
+  ss := s.m[id]
+  if ss != nil { s.remove(ss) }
+  s.mu.Unlock()
+  if ss == nil { return false }
+  ss.cancel()
+  return true
+}
+
+// list: ringkasan singkat semua sesi (untuk admin API).
+func (s *sessionStore) list() []map[string]any {
+  s.mu.Lock()
+  all := make([]*session, 0, len(s.m))
+  for _, ss := range s.m { all = append(all, ss) }
+  s.mu.Unlock()
+  out := make([]map[string]any, 0, len(all))
+  for _, ss := range all {
+    ss.mu.Lock()
+    item := map[string]any{
+      "sessionId": ss.ID, "clientIp": ss.ClientIP, "createdAt": ss.CreatedAt.UTC(),
+      "lastSeen": ss.lastSeen.UTC(), "streams": len(ss.streams),
+    }
+    active := 0
+    for dir, m := range ss.meters {
+      active += m.active
+      item[dir+"Bytes"] = m.total
+    }
+    item["activeStreams"] = active
+    ss.mu.Unlock()
+    out = append(out, item)
+  }
+  return out
+}
+
+// activeWithin: jumlah sesi yang punya stream aktif atau dipakai dalam d terakhir.
+func (s *sessionStore) activeWithin(d time.Duration) int {
+  s.mu.Lock()
+  defer s.mu.Unlock()
+  n := 0
+  for _, ss := range s.m {
+    if ss.idleSince() < d { n++ }
+  }
+  return n
+}
+
+func (ss *session) idleSince() time.Duration {
+  ss.mu.Lock()
+  defer ss.mu.Unlock()
+  for _, m := range ss.meters {
+    if m.active > 0 { return 0 }
+  }
+  return time.Since(ss.lastSeen)
+}
+
+func (ss *session) beginStream(dir string) *streamStat {
+  ss.mu.Lock()
+  defer ss.mu.Unlock()
+  now := time.Now()
+  m := ss.meters[dir]
+  if m == nil {
+    m = &meter{start: now}
+    ss.meters[dir] = m
+  }
+  m.active++
+  m.streams++
+  st := &streamStat{ID: len(ss.streams) + 1, Direction: dir, StartedAt: now}
+  ss.streams = append(ss.streams, st)
+  ss.lastSeen = now
+  return st
+}
+
+func (ss *session) endStream(st *streamStat, tcp *tcpInfo) {
+  ss.mu.Lock()
+  defer ss.mu.Unlock()
+  now := time.Now()
+  st.EndedAt, st.TCP = &now, tcp
+  m := ss.meters[st.Direction]
+  m.active--
+  if now.After(m.end) { m.end = now }
+  ss.lastSeen = now
+}
+
+func (ss *session) add(st *streamStat, n int) {
+  if n <= 0 { return }
+  ss.mu.Lock()
+  defer ss.mu.Unlock()
+  st.Bytes += int64(n)
+  m := ss.meters[st.Direction]
+  i := int(time.Since(m.start) / time.Second)
+  for len(m.buckets) <= i { m.buckets = append(m.buckets, 0) }
+  m.buckets[i] += int64(n)
+  m.total += int64(n)
+}
+
+// phase: fase sesi saat ini menurut stream yang aktif; dipakai untuk memberi label
+// sampel RTT dari kanal latency (loaded latency / bufferbloat).
+func (ss *session) phase() string {
+  ss.mu.Lock()
+  defer ss.mu.Unlock()
+  down := ss.meters["download"] != nil && ss.meters["download"].active > 0
+  up := ss.meters["upload"] != nil && ss.meters["upload"].active > 0
+  switch {
+  case down && up:
+    return "bidirectional"
+  case down:
+    return "download"
+  case up:
+    return "upload"
+  }
+  return "idle"
+}
+
+const maxRTTSamples = 10000 // per fase; 10 ms interval x 100 detik
+
+func (ss *session) addRTT(phase string, d time.Duration) {
+  ss.mu.Lock()
+  defer ss.mu.Unlock()
+  if len(ss.rtts[phase]) < maxRTTSamples { ss.rtts[phase] = append(ss.rtts[phase], d) }
+  ss.lastSeen = time.Now()
+}
+
+type bufferbloat struct {
+  DownloadMs float64 `json:"downloadMs"` // kenaikan median RTT saat download vs idle
+  UploadMs   float64 `json:"uploadMs"`
+  Grade      string  `json:"grade"`
+}
+
+// bufferbloatGrade: skala mirip Waveform dari kenaikan latency terbesar.
+func bufferbloatGrade(ms float64) string {
+  switch {
+  case ms < 5:
+    return "A+"
+  case ms < 30:
+    return "A"
+  case ms < 60:
+    return "B"
+  case ms < 200:
+    return "C"
+  case ms < 400:
+    return "D"
+  }
+  return "F"
+}
+
+// latencySummary: statistik RTT per fase + grade bufferbloat. Baseline = median idle,
+// atau RTT terkecil kalau kanal latency baru dibuka setelah stream mulai. Caller pegang ss.mu.
+func (ss *session) latencySummary() map[string]any {
+  if len(ss.rtts) == 0 { return nil }
+  out := map[string]any{}
+  stats := map[string]latencyStats{}
+  baseline := -1.0
+  for phase, samples := range ss.rtts {
+    st := summarizeRTT(samples)
+    stats[phase], out[phase] = st, st
+    if baseline < 0 || st.MinMs < baseline { baseline = st.MinMs }
+  }
+  if idle, ok := stats["idle"]; ok { baseline = idle.P50Ms }
+  increase := func(phase string) float64 {
+    st, ok := stats[phase]
+    if !ok { return 0 }
+    return round1(max(0, st.P50Ms-baseline))
+  }
+  bb := bufferbloat{DownloadMs: increase("download"), UploadMs: increase("upload")}
+  _, down := stats["download"]
+  _, up := stats["upload"]
+  if down || up {
+    bb.Grade = bufferbloatGrade(max(bb.DownloadMs, bb.UploadMs))
+    out["bufferbloat"] = bb
+  }
+  return out
+}
+
+type rateSample struct {
+  Second int     `json:"t"`
+  Bytes  int64   `json:"bytes"`
+  Mbps   float64 `json:"mbps"`
+}
+
+type phaseSummary struct {
+  Streams    int          `json:"streams"`
+  Active     int          `json:"activeStreams"`
+  TotalBytes int64        `json:"totalBytes"`
+  DurationMs int64        `json:"durationMs"`
+  MeanMbps   float64      `json:"meanMbps"`
+  StableMbps float64      `json:"stableMbps"`
+  Samples    []rateSample `json:"samples"`
+}
+
+func mbps(bytes int64, d time.Duration) float64 {
+  if d <= 0 { return 0 }
+  return float64(bytes) * 8 / d.Seconds() / 1e6
+}
+
+// summary: stable = rata-rata detik penuh setelah membuang 25% sampel awal
+// (slow start TCP); detik terakhir yang belum penuh tidak ikut.
+func (m *meter) summary() phaseSummary {
+  end := m.end
+  if m.active > 0 || end.IsZero() { end = time.Now() }
+  dur := end.Sub(m.start)
+  out := phaseSummary{
+    Streams: m.streams, Active: m.active, TotalBytes: m.total,
+    DurationMs: dur.Milliseconds(), MeanMbps: mbps(m.total, dur),
+    Samples: make([]rateSample, 0, len(m.buckets)),
+  }
+  for i, b := range m.buckets {
+    span := time.Second
+    if rest := dur - time.Duration(i)*time.Second; rest < span { span = rest }
+    out.Samples = append(out.Samples, rateSample{Second: i, Bytes: b, Mbps: mbps(b, span)})
+  }
+
+  full := int(dur / time.Second)
+  if full > len(m.buckets) { full = len(m.buckets) }
+  skip := full / 4
+  if skip == 0 && full >= 3 { skip = 1 }
+  if full-skip <= 0 {
+    out.StableMbps = out.MeanMbps
+    return out
+  }
+  var sum int64
+  for _, b := range m.buckets[skip:full] { sum += b }
+  out.StableMbps = mbps(sum, time.Duration(full-skip)*time.Second)
+  return out
+}
+
+func (ss *session) summary() map[string]any {
+  ss.mu.Lock()
+  defer ss.mu.Unlock()
+  streams := make([]streamStat, len(ss.streams)) // salin, karena Bytes terus berubah
+  for i, st := range ss.streams { streams[i] = *st }
+  out := map[string]any{
+    "sessionId": ss.ID,
+    "createdAt": ss.CreatedAt.UTC(),
+    "streams":   streams,
+  }
+  for dir, m := range ss.meters { out[dir] = m.summary() }
+  if lat := ss.latencySummary(); lat != nil { out["latency"] = lat }
+  if ss.impair != nil { out["impairment"] = ss.impair }
+  return out
+}
+
+// ---------- HTTP ----------
+
+func apiCreateSession(w http.ResponseWriter, r *http.Request) {
+  if r.Method != http.MethodPost { http.Error(w, "method not allowed", http.StatusMethodNotAllowed); return }
+  if refusingTests() { rejectDraining(w); return }
+  imp, err := parseImpairment(r.URL.Query())
+  if err != nil { http.Error(w, err.Error(), http.StatusBadRequest); return }
+  ss, err := sessions.create(clientIP(r), imp)
+  if errors.Is(err, errClientSessions) {
+    metrics.reject("sessions")
+    w.Header().Set("Retry-After", strconv.Itoa(limits.Load().RetryAfterSec))
+    http.Error(w, err.Error(), http.StatusTooManyRequests)
+    return
+  }
+  if err != nil {
+    metrics.reject("sessions")
+    http.Error(w, err.Error(), http.StatusServiceUnavailable)
+    return
+  }
+  base := "/api/v1/sessions/" + ss.ID
+  w.Header().Set("Content-Type", "application/json")
+  w.Header().Set("Cache-Control", "no-store")
+  w.WriteHeader(http.StatusCreated)
+  resp := map[string]any{
+    "sessionId":   ss.ID,
+    "downloadUrl": base + "/download",
+    "uploadUrl":   base + "/upload",
+    "latencyUrl":  base + "/ws?mode=latency",
+    "resultUrl":   base,
+    "ttlSec":      int(sessions.ttl / time.Second),
+  }
+  if imp != nil { resp["impairment"] = imp }
+  _ = json.NewEncoder(w).Encode(resp)
+}
+
+func apiGetSession(w http.ResponseWriter, r *http.Request) {
+  ss := sessions.get(r.PathValue("id"))
+  if ss == nil { http.Error(w, "session not found", http.StatusNotFound); return }
+  w.Header().Set("Content-Type", "application/json")
+  w.Header().Set("Cache-Control", "no-store")
+  _ = json.NewEncoder(w).Encode(ss.summary())
+}
+
+func apiSessionDownload(w http.ResponseWriter, r *http.Request) {
+  ss := sessions.get(r.PathValue("id"))
+  if ss == nil { http.Error(w, "session not found", http.StatusNotFound); return }
+  serveDownload(w, r, ss)
+}
+
+func apiSessionUpload(w http.ResponseWriter, r *http.Request) {
+  ss := sessions.get(r.PathValue("id"))
+  if ss == nil { http.Error(w, "session not found", http.StatusNotFound); return }
+  serveUpload(w, r, ss)
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+  "errors"
+  "math"
+  "testing"
+  "time"
+)
+
+func TestBufferbloatGrade(t *testing.T) {
+  tests := []struct {
+    ms   float64
+    want string
+  }{
+    {0, "A+"}, {4.9, "A+"}, {5, "A"}, {29.9, "A"}, {30, "B"}, {59, "B"},
+    {60, "C"}, {199, "C"}, {200, "D"}, {399, "D"}, {400, "F"}, {5000, "F"},
+  }
+  for _, tt := range tests {
+    if got := bufferbloatGrade(tt.ms); got != tt.want {
+      t.Errorf("bufferbloatGrade(%v) = %q, want %q", tt.ms, got, tt.want)
+    }
+  }
+}
+
+func TestMeterSummary(t *testing.T) {
+  const mb = 1_000_000
+  tests := []struct {
+    name       string
+    dur        time.Duration
+    buckets    []int64
+    wantMean   float64
+    wantStable float64
+  }{
+    // 25% detik awal (slow start) dibuang: 1 dari 4
+    {"skip slow start", 4 * time.Second, []int64{1 * mb, 5 * mb, 5 * mb, 5 * mb}, 32, 40},
+    // 3 detik penuh: minimal 1 detik dibuang
+    {"three seconds", 3 * time.Second, []int64{mb, 2 * mb, 2 * mb}, 40 / 3.0, 16},
+    // detik terakhir yang belum penuh tidak ikut
+    {"partial last second", 2500 * time.Millisecond, []int64{2 * mb, 2 * mb, mb}, 16, 16},
+    // kurang dari satu detik penuh: stable = mean
+    {"too short", 500 * time.Millisecond, []int64{mb}, 16, 16},
+    {"empty", time.Second, nil, 0, 0},
+  }
+  for _, tt := range tests {
+    t.Run(tt.name, func(t *testing.T) {
+      start := time.Now().Add(-time.Hour)
+      m := &meter{start: start, end: start.Add(tt.dur), streams: 2, buckets: tt.buckets}
+      for _, b := range tt.buckets { m.total += b }
+      got := m.summary()
+      if math.Abs(got.MeanMbps-tt.wantMean) > 1e-9 { t.Errorf("MeanMbps = %v, want %v", got.MeanMbps, tt.wantMean) }
+      if math.Abs(got.StableMbps-tt.wantStable) > 1e-9 { t.Errorf("StableMbps = %v, want %v", got.StableMbps, tt.wantStable) }
+      if len(got.Samples) != len(tt.buckets) { t.Errorf("len(Samples) = %d, want %d", len(got.Samples), len(tt.buckets)) }
+      if got.DurationMs != tt.dur.Milliseconds() { t.Errorf("DurationMs = %d, want %d", got.DurationMs, tt.dur.Milliseconds()) }
+    })
+  }
+}
+
+func TestLatencySummaryBaseline(t *testing.T) {
+  ms := func(v ...float64) []time.Duration {
+    out := make([]time.Duration, len(v))
+    for i, x := range v { out[i] = time.Duration(x * float64(time.Millisecond)) }
+    return out
+  }
+  ss := &session{rtts: map[string][]time.Duration{
+    "idle":     ms(10, 10, 10),
+    "download": ms(50, 50, 50),
+    "upload":   ms(20, 20, 20),
+  }}
+  bb, ok := ss.latencySummary()["bufferbloat"].(bufferbloat)
+  if !ok { t.Fatal("no bufferbloat in summary") }
+  if bb.DownloadMs != 40 || bb.UploadMs != 10 || bb.Grade != "B" {
+    t.Errorf("bufferbloat = %+v, want download 40, upload 10, grade B", bb)
+  }
+
+  // tanpa fase idle: baseline = RTT terkecil
+  ss = &session{rtts: map[string][]time.Duration{"download": ms(3, 3, 3)}}
+  bb = ss.latencySummary()["bufferbloat"].(bufferbloat)
+  if bb.DownloadMs != 0 || bb.Grade != "A+" { t.Errorf("bufferbloat = %+v, want 0 / A+", bb) }
+
+  if (&session{rtts: map[string][]time.Duration{}}).latencySummary() != nil { t.Error("empty rtts should give nil summary") }
+}
+
+func TestSessionStorePerClientLimit(t *testing.T) {
+  s := &sessionStore{m: map[string]*session{}, perIP: map[string]int{}, ttl: time.Minute, max: 3, maxIP: 2}
+  a1, err := s.create("10.0.0.1", nil)
+  if err != nil { t.Fatal(err) }
+  if _, err := s.create("10.0.0.1", nil); err != nil { t.Fatal(err) }
+  if _, err := s.create("10.0.0.1", nil); !errors.Is(err, errClientSessions) { t.Fatalf("3rd session for same IP: err = %v, want errClientSessions", err) }
+  if _, err := s.create("10.0.0.2", nil); err != nil { t.Fatal(err) }
+  if _, err := s.create("10.0.0.3", nil); !errors.Is(err, errSessionsFull) { t.Fatalf("node full: err = %v, want errSessionsFull", err) }
+
+  if !s.kill(a1.ID) { t.Fatal("kill failed") }
+  if s.perIP["10.0.0.1"] != 1 { t.Errorf("perIP after kill = %d, want 1", s.perIP["10.0.0.1"]) }
+  if _, err := s.create("10.0.0.1", nil); err != nil { t.Errorf("after kill: %v", err) }
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+  "context"
+  "encoding/json"
+  "errors"
+  "io"
+  "net/http"
+  "strconv"
+  "sync/atomic"
+  "time"
+)
+
+// serveDownload dipakai /api/v1/download dan /api/v1/sessions/{id}/download.
+// ss boleh nil (tes tanpa sesi).
+func serveDownload(w http.ResponseWriter, r *http.Request, ss *session) {
+  w.Header().Set("Content-Type", "application/octet-stream")
+  w.Header().Set("Cache-Control", "no-store, no-cache, must-revalidate, proxy-revalidate")
+  w.Header().Set("Trailer", "X-Tcp-Info") // TCP_INFO di akhir stream (kalau tersedia)
+
+  q := r.URL.Query()
+  timeSec, _ := strconv.ParseInt(q.Get("time"), 10, 64)
+  bytesTarget, _ := strconv.ParseInt(q.Get("bytes"), 10, 64)
+  gen, err := newPayload(q.Get("pattern"))
+  if err != nil { http.Error(w, err.Error(), http.StatusBadRequest); return }
+  if cc := q.Get("cc"); cc != "" {
+    applied, restore, err := applyCC(r, cc)
+    if err != nil { http.Error(w, err.Error(), http.StatusBadRequest); return }
+    defer restore()
+    w.Header().Set("X-Congestion-Control", applied)
+  }
+  im, err := requestImpairment(q, ss)
+  if err != nil { http.Error(w, err.Error(), http.StatusBadRequest); return }
+  bufp := chunkPool.Get().(*[]byte)
+  defer chunkPool.Put(bufp)
+  buf := *bufp
+
+  // selalu ada batas: time/bytes di-clamp ke limit node (dan sisa budget egress)
+  ip := clientIP(r)
+  rem, ok := quota.admitDownload(w, ip)
+  if !ok { return }
+  start := time.Now()
+  deadline := start.Add(clampDuration(timeSec))
+  bytesTarget = clampBytes(bytesTarget)
+  if rem >= 0 {
+    bytesTarget = min(bytesTarget, rem)
+    w.Header().Set("X-Quota-Remaining", strconv.FormatInt(rem, 10))
+  }
+
+  var st *streamStat
+  if ss != nil {
+    st = ss.beginStream("download")
+    defer func() { ss.endStream(st, requestTCPInfo(r)) }()
+  }
+
+  metrics.activeDown.Add(1)
+  defer metrics.activeDown.Add(-1)
+
+  if im != nil {
+    w.Header().Set("X-Impairment", im.name)
+    im.wait() // delay sebelum byte pertama
+    buf = buf[:im.segment(len(buf))]
+  }
+  var sent int64
+  fl, _ := w.(http.Flusher)
+  for {
+    if time.Now().After(deadline) { break }
+    if sent >= bytesTarget { break }
+    if ss != nil && ss.ctx.Err() != nil { break } // sesi di-kill
+    gen.fill(buf)
+    allowed := quota.add(ip, len(buf)) // dipesan dulu; < len(buf) = budget/kuota habis
+    n, err := w.Write(buf[:allowed])
+    sent += int64(n)
+    metrics.bytesSent.Add(int64(n))
+    if st != nil { ss.add(st, n) }
+    if err != nil || allowed < len(buf) { break }
+    if fl != nil { fl.Flush() }
+    if im.step(n) != nil { impairAbort(r) }
+  }
+  if ti := requestTCPInfo(r); ti != nil {
+    b, _ := json.Marshal(ti)
+    w.Header().Set("X-Tcp-Info", string(b))
+  }
+}
+
+// serveUpload dipakai /api/v1/upload dan /api/v1/sessions/{id}/upload.
+func serveUpload(w http.ResponseWriter, r *http.Request, ss *session) {
+  w.Header().Set("Cache-Control", "no-store")
+  im, err := requestImpairment(r.URL.Query(), ss)
+  if err != nil { http.Error(w, err.Error(), http.StatusBadRequest); return }
+  if im != nil { w.Header().Set("X-Impairment", im.name) }
+  v, err := newUploadVerifier(r.URL.Query(), r.Header, r.ContentLength)
+  if err != nil { http.Error(w, err.Error(), http.StatusBadRequest); return }
+  start := time.Now()
+  received, st, tcp := receiveUpload(w, r, ss, im, v)
+  resp := map[string]any{
+    "receivedBytes": received,
+    "durationMs":    time.Since(start).Milliseconds(),
+  }
+  if tcp != nil { resp["tcp"] = tcp }
+  if res := v.result(r.Trailer); res != nil { resp["integrity"] = res }
+  if ss != nil { resp["sessionId"] = ss.ID; resp["streamId"] = st.ID }
+  w.Header().Set("Content-Type", "application/json")
+  _ = json.NewEncoder(w).Encode(resp)
+}
+
+// receiveUpload membaca & membuang body (dengan batas waktu/byte dan akuntansi sesi).
+// im (boleh nil): pacing/stall/reset dari mode impairment; v (boleh nil): verify=.
+func receiveUpload(w http.ResponseWriter, r *http.Request, ss *session, im *impairment, v *uploadVerifier) (received int64, st *streamStat, tcp *tcpInfo) {
+  // time=... opsional, dipakai sebagai "safety guard" (di-clamp ke MAX_DURATION_SEC)
+  q := r.URL.Query()
+  timeSec, _ := strconv.ParseInt(q.Get("time"), 10, 64)
+
+  // Guard: kalau klien tak menutup stream, paksa close sedikit setelah durasi
+  var timedOut atomic.Bool
+  guard := time.AfterFunc(clampDuration(timeSec)+time.Second, func() {
+    timedOut.Store(true)
+    _ = r.Body.Close() // memicu EOF di loop baca
+  })
+  defer guard.Stop()
+
+  // byte di atas MAX_STREAM_MB tidak dibaca lagi
+  r.Body = http.MaxBytesReader(w, r.Body, clampBytes(0))
+
+  if ss != nil {
+    st = ss.beginStream("upload")
+    stop := context.AfterFunc(ss.ctx, func() { _ = r.Body.Close() }) // sesi di-kill
+    defer stop()
+  }
+
+  metrics.activeUp.Add(1)
+  defer metrics.activeUp.Add(-1)
+
+  buf := make([]byte, 1<<20) // 1 MiB
+  buf = buf[:im.segment(len(buf))]
+  im.wait()
+  for {
+    n, err := r.Body.Read(buf)
+    if n > 0 {
+      received += int64(n)
+      metrics.bytesReceived.Add(int64(n))
+      if st != nil { ss.add(st, n) }
+      if v != nil { _, _ = v.Write(buf[:n]) }
+      if im.step(n) != nil {
+        if ss != nil { ss.endStream(st, requestTCPInfo(r)) }
+        impairAbort(r)
+      }
+    }
+    if err == io.EOF { break }
+    if err != nil {
+      // catat kalau node sendiri yang menghentikan stream, supaya verify= tidak
+      // melaporkannya sebagai upload terpotong
+      var tooBig *http.MaxBytesError
+      switch {
+      case errors.As(err, &tooBig): v.stop("bytes")
+      case timedOut.Load(): v.stop("time")
+      case ss != nil && ss.ctx.Err() != nil: v.stop("session")
+      }
+      break
+    }
+  }
+  _ = r.Body.Close() // rapikan koneksi
+
+  tcp = requestTCPInfo(r)
+  if ss != nil { ss.endStream(st, tcp) }
+  return received, st, tcp
+}
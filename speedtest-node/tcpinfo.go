@@ -0,0 +1,55 @@
+package main
+
+import (
+  "context"
+  "crypto/tls"
+  "net"
+  "net/http"
+)
+
+// Statistik TCP_INFO dari koneksi tes (Linux). Membedakan "path-nya lossy"
+// (retransmit tinggi, cwnd kecil) dari "kliennya lambat" (rtt rendah, tanpa retransmit).
+// Di HTTP/2 nilainya per koneksi (dipakai bersama oleh semua stream), di HTTP/3 tidak ada.
+type tcpInfo struct {
+  RTTMs            float64 `json:"rttMs"`    // smoothed RTT
+  RTTVarMs         float64 `json:"rttVarMs"` // variansi RTT
+  Retransmits      uint32  `json:"retransmits"`
+  Cwnd             uint32  `json:"cwnd"` // segmen
+  MSS              uint32  `json:"mss"`
+  DeliveryRateMbps float64 `json:"deliveryRateMbps"`
+  PacingRateMbps   float64 `json:"pacingRateMbps"`
+  BytesAcked       uint64  `json:"bytesAcked"`
+  CC               string  `json:"cc,omitempty"` // congestion control yang dipakai
+}
+
+type connCtxKey struct{}
+
+// saveConn dipasang sebagai http.Server.ConnContext supaya handler bisa membaca socket-nya.
+func saveConn(ctx context.Context, c net.Conn) context.Context {
+  return context.WithValue(ctx, connCtxKey{}, c)
+}
+
+// requestTCPInfo: TCP_INFO koneksi di balik request; nil kalau tidak tersedia.
+func requestTCPInfo(r *http.Request) *tcpInfo {
+  c := requestTCPConn(r)
+  if c == nil { return nil }
+  return readTCPInfo(c)
+}
+
+func connTCPInfo(c net.Conn) *tcpInfo {
+  tc := tcpConnOf(c)
+  if tc == nil { return nil }
+  return readTCPInfo(tc)
+}
+
+// requestTCPConn: socket TCP di balik request (nil untuk HTTP/3).
+func requestTCPConn(r *http.Request) *net.TCPConn {
+  c, _ := r.Context().Value(connCtxKey{}).(net.Conn)
+  return tcpConnOf(c)
+}
+
+func tcpConnOf(c net.Conn) *net.TCPConn {
+  if tc, ok := c.(*tls.Conn); ok { c = tc.NetConn() }
+  tc, _ := c.(*net.TCPConn)
+  return tc
+}
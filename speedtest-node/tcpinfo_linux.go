@@ -0,0 +1,34 @@
+//go:build linux
+
+package main
+
+import (
+  "net"
+
+  "golang.org/x/sys/unix"
+)
+
+func readTCPInfo(c *net.TCPConn) *tcpInfo {
+  raw, err := c.SyscallConn()
+  if err != nil { return nil }
+  var ti *unix.TCPInfo
+  var gerr error
+  if err := raw.Control(func(fd uintptr) {
+    ti, gerr = unix.GetsockoptTCPInfo(int(fd), unix.IPPROTO_TCP, unix.TCP_INFO)
+  }); err != nil || gerr != nil {
+    return nil
+  }
+  var pacing float64
+  if ti.Pacing_rate != ^uint64(0) { pacing = round1(float64(ti.Pacing_rate) * 8 / 1e6) } // ~0 = tanpa pacing
+  return &tcpInfo{
+    RTTMs:            float64(ti.Rtt) / 1000, // kernel: µs
+    RTTVarMs:         float64(ti.Rttvar) / 1000,
+    Retransmits:      ti.Total_retrans,
+    Cwnd:             ti.Snd_cwnd,
+    MSS:              ti.Snd_mss,
+    DeliveryRateMbps: round1(float64(ti.Delivery_rate) * 8 / 1e6), // kernel: byte/detik
+    PacingRateMbps:   pacing,
+    BytesAcked:       ti.Bytes_acked,
+    CC:               getCC(c),
+  }
+}
@@ -0,0 +1,8 @@
+//go:build !linux
+
+package main
+
+import "net"
+
+// TCP_INFO hanya dibaca di Linux.
+func readTCPInfo(*net.TCPConn) *tcpInfo { return nil }
@@ -0,0 +1,79 @@
+package main
+
+import (
+  "crypto/tls"
+  "fmt"
+  "log"
+  "os"
+  "sync"
+  "time"
+)
+
+// certReloader memuat ulang TLS_CERT/TLS_KEY kalau file-nya berubah (rotasi
+// certbot/cert-manager) tanpa restart. Kalau reload gagal, cert lama tetap dipakai.
+type certReloader struct {
+  certFile, keyFile string
+
+  mu      sync.RWMutex
+  cert    *tls.Certificate
+  modTime time.Time
+}
+
+func newCertReloader(certFile, keyFile string) (*certReloader, error) {
+  c := &certReloader{certFile: certFile, keyFile: keyFile}
+  if err := c.reload(); err != nil { return nil, err }
+  return c, nil
+}
+
+func (c *certReloader) latestModTime() (time.Time, error) {
+  var latest time.Time
+  for _, f := range []string{c.certFile, c.keyFile} {
+    st, err := os.Stat(f)
+    if err != nil { return time.Time{}, err }
+    if st.ModTime().After(latest) { latest = st.ModTime() }
+  }
+  return latest, nil
+}
+
+func (c *certReloader) reload() error {
+  mt, err := c.latestModTime()
+  if err != nil { return err }
+  cert, err := tls.LoadX509KeyPair(c.certFile, c.keyFile)
+  if err != nil { return fmt.Errorf("load TLS keypair: %w", err) }
+  c.mu.Lock()
+  c.cert, c.modTime = &cert, mt
+  c.mu.Unlock()
+  return nil
+}
+
+// watch cek mtime tiap interval; cukup untuk rotasi yang biasanya harian/bulanan.
+func (c *certReloader) watch(every time.Duration) {
+  for range time.Tick(every) {
+    mt, err := c.latestModTime()
+    c.mu.RLock()
+    changed := err == nil && !mt.Equal(c.modTime)
+    c.mu.RUnlock()
+    if !changed { continue }
+    if err := c.reload(); err != nil {
+      log.Printf("TLS reload failed, keeping old certificate: %v", err)
+      continue
+    }
+    log.Printf("TLS certificate reloaded from %s", c.certFile)
+  }
+}
+
+func (c *certReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+  c.mu.RLock()
+  defer c.mu.RUnlock()
+  return c.cert, nil
+}
+
+// tlsConfig: h2 dinegosiasikan via ALPN, jadi browser bisa multiplex stream
+// download/upload di satu koneksi.
+func (c *certReloader) tlsConfig() *tls.Config {
+  return &tls.Config{
+    MinVersion:     tls.VersionTLS12,
+    GetCertificate: c.GetCertificate,
+    NextProtos:     []string{"h2", "http/1.1"},
+  }
+}
@@ -0,0 +1,313 @@
+package main
+
+import (
+  "crypto/rand"
+  "encoding/binary"
+  "encoding/hex"
+  "encoding/json"
+  "fmt"
+  "log"
+  "math"
+  "net"
+  "net/http"
+  "sync"
+  "time"
+)
+
+// Tes UDP jitter/packet loss (untuk keluhan VoIP/gaming).
+//
+// Handshake lewat HTTP: POST /api/v1/udp/sessions {"rate":pps,"size":bytes,"durationSec":n}
+// → {id, token, port, ...}. Klien lalu mengirim datagram bernomor ke UDP_ADDR; node
+// memantulkan tiap datagram (reflect) dengan nomor urut & timestamp sendiri. Klien
+// menaruh statistik penerimaan pantulan di datagram berikutnya, jadi node bisa
+// melaporkan kedua arah di GET /api/v1/udp/sessions/{id}.
+//
+// Format datagram (big-endian, minimal 64 byte, sisanya padding):
+//
+//   0  magic "JSU1"
+//   4  type: 1=probe (klien→node), 2=reflect (node→klien), 3=fin (klien→node, tidak dipantulkan)
+//   8  token (8 byte, dari handshake)
+//   16 seq uint32 (probe: mulai 0; fin: jumlah probe yang dikirim)
+//   20 txTime int64 µs (jam pengirim)
+//   probe/fin:  28 rxCount u32 | 32 rxDup u32 | 36 rxReorder u32 | 40 lastRxSeq u32 | 44 lastRxTime i64 µs (jam klien)
+//   reflect:    28 echoSeq u32 | 32 echoTxTime i64 | 40 nodeRxTime i64 µs
+
+const (
+  udpMagic      = "JSU1"
+  udpHeaderSize = 52
+  udpMinSize    = 64
+  udpMaxSize    = 1400
+  udpProbe      = 1
+  udpReflect    = 2
+  udpFin        = 3
+)
+
+type udpDirection struct {
+  Sent       int64   `json:"sent"`
+  Received   int64   `json:"received"`
+  Lost       int64   `json:"lost"`
+  LossPct    float64 `json:"lossPct"`
+  Duplicates int64   `json:"duplicates"`
+  Reordered  int64   `json:"reordered"`
+  JitterMs   float64 `json:"jitterMs"` // RFC 3550 (J += (|D|-J)/16)
+}
+
+// rfcJitter: estimator jitter RFC 3550 §6.4.1 dari selisih transit time.
+type rfcJitter struct {
+  j        float64 // µs
+  last     int64
+  haveLast bool
+}
+
+func (r *rfcJitter) add(transit int64) {
+  if r.haveLast {
+    d := float64(transit - r.last)
+    if d < 0 { d = -d }
+    r.j += (d - r.j) / 16
+  }
+  r.last, r.haveLast = transit, true
+}
+
+type udpTest struct {
+  ID       string
+  token    [8]byte
+  Rate     int
+  Size     int
+  Duration time.Duration
+  created  time.Time
+  release  func()
+  once     sync.Once
+
+  mu       sync.Mutex
+  started  time.Time
+  finished bool
+  budget   int // batas datagram yang diproses (rate*durasi + margin)
+
+  // upstream (diukur node)
+  seen       []bool
+  maxSeq     int64
+  upRecv     int64
+  upDup      int64
+  upReorder  int64
+  upJitter   rfcJitter
+  clientSent int64 // dari fin; 0 = belum tahu
+
+  // downstream (pantulan node, statistik dari feedback klien)
+  downTx     []int64 // nodeTx µs per seq pantulan
+  fbRecv     int64
+  fbDup      int64
+  fbReorder  int64
+  lastFbSeq  int64
+  downJitter rfcJitter
+}
+
+type udpService struct {
+  conn *net.UDPConn
+  port int
+
+  mu      sync.Mutex
+  byID    map[string]*udpTest
+  byToken map[[8]byte]*udpTest
+}
+
+var udpSvc *udpService
+
+func startUDPService(addr string) error {
+  ua, err := net.ResolveUDPAddr("udp", addr)
+  if err != nil { return err }
+  conn, err := net.ListenUDP("udp", ua)
+  if err != nil { return err }
+  _ = conn.SetReadBuffer(4 << 20)
+  _ = conn.SetWriteBuffer(4 << 20)
+  udpSvc = &udpService{
+    conn: conn, port: conn.LocalAddr().(*net.UDPAddr).Port,
+    byID: map[string]*udpTest{}, byToken: map[[8]byte]*udpTest{},
+  }
+  go udpSvc.serve()
+  go udpSvc.janitor()
+  return nil
+}
+
+func (s *udpService) serve() {
+  buf := make([]byte, 2048)
+  out := make([]byte, udpMaxSize)
+  for {
+    n, from, err := s.conn.ReadFromUDP(buf)
+    if err != nil {
+      log.Printf("udp read: %v", err)
+      return
+    }
+    now := time.Now().UnixMicro()
+    p := buf[:n]
+    if n < udpHeaderSize || string(p[:4]) != udpMagic { continue }
+    var tok [8]byte
+    copy(tok[:], p[8:16])
+    s.mu.Lock()
+    t := s.byToken[tok]
+    s.mu.Unlock()
+    if t == nil { continue }
+    if size := t.handle(p, now, out); size > 0 {
+      _, _ = s.conn.WriteToUDP(out[:size], from)
+    }
+  }
+}
+
+// handle memproses satu datagram; mengembalikan ukuran pantulan di out (0 = tidak dipantulkan).
+// Datagram terpotong, magic salah atau token tes lain diabaikan tanpa dihitung.
+func (t *udpTest) handle(p []byte, now int64, out []byte) int {
+  if len(p) < udpHeaderSize || string(p[:4]) != udpMagic || [8]byte(p[8:16]) != t.token { return 0 }
+  typ := p[4]
+  seq := int64(binary.BigEndian.Uint32(p[16:20]))
+  txTime := int64(binary.BigEndian.Uint64(p[20:28]))
+
+  t.mu.Lock()
+  defer t.mu.Unlock()
+  if t.started.IsZero() { t.started = time.Now() }
+
+  // feedback klien tentang pantulan yang diterimanya (nilai kumulatif)
+  t.fbRecv = max(t.fbRecv, int64(binary.BigEndian.Uint32(p[28:32])))
+  t.fbDup = max(t.fbDup, int64(binary.BigEndian.Uint32(p[32:36])))
+  t.fbReorder = max(t.fbReorder, int64(binary.BigEndian.Uint32(p[36:40])))
+  if t.fbRecv > 0 {
+    lastRxSeq := int64(binary.BigEndian.Uint32(p[40:44]))
+    lastRxTime := int64(binary.BigEndian.Uint64(p[44:52]))
+    if lastRxSeq != t.lastFbSeq && lastRxSeq < int64(len(t.downTx)) {
+      t.downJitter.add(lastRxTime - t.downTx[lastRxSeq])
+      t.lastFbSeq = lastRxSeq
+    }
+  }
+
+  switch typ {
+  case udpFin:
+    t.clientSent = seq
+    t.finished = true
+    t.once.Do(t.release)
+    return 0
+  case udpProbe:
+  default:
+    return 0
+  }
+  if t.finished || seq >= int64(t.budget) { return 0 }
+  if t.seen[seq] {
+    t.upDup++
+    return 0
+  }
+  t.seen[seq] = true
+  t.upRecv++
+  if seq < t.maxSeq { t.upReorder++ } else { t.maxSeq = seq }
+  t.upJitter.add(now - txTime)
+
+  if len(t.downTx) >= t.budget { return 0 }
+  size := min(len(p), t.Size, len(out))
+  clear(out[:size])
+  copy(out[0:4], udpMagic)
+  out[4] = udpReflect
+  copy(out[8:16], t.token[:])
+  binary.BigEndian.PutUint32(out[16:20], uint32(len(t.downTx)))
+  binary.BigEndian.PutUint32(out[28:32], uint32(seq))
+  binary.BigEndian.PutUint64(out[32:40], uint64(txTime))
+  binary.BigEndian.PutUint64(out[40:48], uint64(now))
+  nodeTx := time.Now().UnixMicro()
+  binary.BigEndian.PutUint64(out[20:28], uint64(nodeTx))
+  t.downTx = append(t.downTx, nodeTx)
+  return size
+}
+
+func lossOf(d udpDirection) udpDirection {
+  d.Lost = max(0, d.Sent-d.Received)
+  if d.Sent > 0 { d.LossPct = math.Round(10000*float64(d.Lost)/float64(d.Sent)) / 100 }
+  return d
+}
+
+func (t *udpTest) report() map[string]any {
+  t.mu.Lock()
+  defer t.mu.Unlock()
+  state := "pending"
+  if !t.started.IsZero() { state = "running" }
+  if t.finished || (!t.started.IsZero() && time.Since(t.started) > t.Duration+5*time.Second) { state = "done" }
+
+  upSent := t.maxSeq + 1
+  if t.clientSent > 0 { upSent = t.clientSent }
+  up := lossOf(udpDirection{
+    Sent: upSent, Received: t.upRecv, Duplicates: t.upDup, Reordered: t.upReorder, JitterMs: t.upJitter.j / 1000,
+  })
+  down := lossOf(udpDirection{
+    Sent: int64(len(t.downTx)), Received: t.fbRecv, Duplicates: t.fbDup, Reordered: t.fbReorder, JitterMs: t.downJitter.j / 1000,
+  })
+  return map[string]any{
+    "id": t.ID, "state": state, "rate": t.Rate, "size": t.Size, "durationSec": int(t.Duration / time.Second),
+    "upstream": up, "downstream": down,
+  }
+}
+
+func (s *udpService) janitor() {
+  for range time.Tick(time.Minute) {
+    s.mu.Lock()
+    for id, t := range s.byID {
+      if time.Since(t.created) > t.Duration+sessions.ttl {
+        t.once.Do(t.release)
+        delete(s.byID, id)
+        delete(s.byToken, t.token)
+      }
+    }
+    s.mu.Unlock()
+  }
+}
+
+// ---------- HTTP ----------
+
+func apiCreateUDPTest(w http.ResponseWriter, r *http.Request) {
+  if r.Method != http.MethodPost { http.Error(w, "method not allowed", http.StatusMethodNotAllowed); return }
+  var in struct {
+    Rate        int   `json:"rate"`
+    Size        int   `json:"size"`
+    DurationSec int64 `json:"durationSec"`
+  }
+  if err := json.NewDecoder(r.Body).Decode(&in); err != nil { http.Error(w, "bad json", http.StatusBadRequest); return }
+  if in.Rate <= 0 { in.Rate = 50 }
+  if in.Size == 0 { in.Size = 200 }
+  maxPPS := getenvInt("UDP_MAX_PPS", 2000)
+  if in.Rate > maxPPS || in.Size < udpMinSize || in.Size > udpMaxSize {
+    http.Error(w, fmt.Sprintf("rate must be 1..%d pps, size %d..%d bytes", maxPPS, udpMinSize, udpMaxSize), http.StatusBadRequest)
+    return
+  }
+
+  if refusingTests() { rejectDraining(w); return }
+  // tes UDP memakai satu slot stream selama durasinya
+  ip := clientIP(r)
+  if !admit.acquire(ip) { rejectBusy(w); return }
+
+  dur := clampDuration(in.DurationSec)
+  budget := int(float64(in.Rate)*dur.Seconds()*1.2) + 100
+  t := &udpTest{
+    ID: newSessionID(), Rate: in.Rate, Size: in.Size, Duration: dur, created: time.Now(),
+    budget: budget, seen: make([]bool, budget), maxSeq: -1, lastFbSeq: -1,
+    release: func() { admit.release(ip) },
+  }
+  _, _ = rand.Read(t.token[:])
+  time.AfterFunc(dur+10*time.Second, func() { t.once.Do(t.release) })
+
+  udpSvc.mu.Lock()
+  udpSvc.byID[t.ID] = t
+  udpSvc.byToken[t.token] = t
+  udpSvc.mu.Unlock()
+
+  w.Header().Set("Content-Type", "application/json")
+  w.Header().Set("Cache-Control", "no-store")
+  w.WriteHeader(http.StatusCreated)
+  _ = json.NewEncoder(w).Encode(map[string]any{
+    "id": t.ID, "token": hex.EncodeToString(t.token[:]), "port": udpSvc.port,
+    "rate": t.Rate, "size": t.Size, "durationSec": int(dur / time.Second),
+    "resultUrl": "/api/v1/udp/sessions/" + t.ID, "format": udpMagic,
+  })
+}
+
+func apiGetUDPTest(w http.ResponseWriter, r *http.Request) {
+  udpSvc.mu.Lock()
+  t := udpSvc.byID[r.PathValue("id")]
+  udpSvc.mu.Unlock()
+  if t == nil { http.Error(w, "udp session not found", http.StatusNotFound); return }
+  w.Header().Set("Content-Type", "application/json")
+  w.Header().Set("Cache-Control", "no-store")
+  _ = json.NewEncoder(w).Encode(t.report())
+}
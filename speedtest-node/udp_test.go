@@ -0,0 +1,114 @@
+package main
+
+import (
+  "encoding/binary"
+  "math"
+  "testing"
+  "time"
+)
+
+var udpTestToken = [8]byte{1, 2, 3, 4, 5, 6, 7, 8}
+
+func newTestUDPTest() *udpTest {
+  const budget = 100
+  return &udpTest{
+    ID: "t", Rate: 50, Size: udpMinSize, Duration: time.Second, created: time.Now(), token: udpTestToken,
+    budget: budget, seen: make([]bool, budget), maxSeq: -1, lastFbSeq: -1, release: func() {},
+  }
+}
+
+// udpPacket: datagram JSU1; fb = rxCount, rxDup, rxReorder (feedback klien tentang pantulan).
+type udpPacket struct {
+  typ      byte
+  seq      uint32
+  txTime   int64 // µs, jam klien
+  now      int64 // µs, waktu terima di node
+  fb       [3]uint32
+  token    *[8]byte // nil = token tes
+  magic    string   // kosong = JSU1
+  truncate int      // > 0: panjang datagram
+}
+
+func (pk udpPacket) bytes() []byte {
+  p := make([]byte, udpMinSize)
+  copy(p, udpMagic)
+  if pk.magic != "" { copy(p, pk.magic) }
+  p[4] = pk.typ
+  if p[4] == 0 { p[4] = udpProbe }
+  tok := udpTestToken
+  if pk.token != nil { tok = *pk.token }
+  copy(p[8:16], tok[:])
+  binary.BigEndian.PutUint32(p[16:], pk.seq)
+  binary.BigEndian.PutUint64(p[20:], uint64(pk.txTime))
+  for i, v := range pk.fb { binary.BigEndian.PutUint32(p[28+4*i:], v) }
+  if pk.truncate > 0 { p = p[:pk.truncate] }
+  return p
+}
+
+// probes: seq berurutan dengan transit tetap 1 ms.
+func probes(seqs ...uint32) []udpPacket {
+  out := make([]udpPacket, len(seqs))
+  for i, s := range seqs { out[i] = udpPacket{seq: s, txTime: int64(s) * 20000, now: int64(s)*20000 + 1000} }
+  return out
+}
+
+func TestUDPHandle(t *testing.T) {
+  other := [8]byte{9, 9, 9, 9, 9, 9, 9, 9}
+  // jitter RFC 3550: transit 1000/3000/1000 µs -> |D| = 2000 dua kali -> J = 2000*(1-(15/16)^2) µs
+  jitterMs := 2 * (1 - math.Pow(15.0/16, 2))
+  tests := []struct {
+    name     string
+    packets  []udpPacket
+    want     udpDirection
+    reflects int
+  }{
+    {"in order", probes(0, 1, 2, 3, 4), udpDirection{Sent: 5, Received: 5}, 5},
+    {"gap", probes(0, 1, 4), udpDirection{Sent: 5, Received: 3, Lost: 2, LossPct: 40}, 3},
+    {"duplicate", probes(0, 1, 1, 2), udpDirection{Sent: 3, Received: 3, Duplicates: 1}, 3},
+    {"out of order", probes(0, 2, 1, 3), udpDirection{Sent: 4, Received: 4, Reordered: 1}, 4},
+    {"late after gap", probes(0, 3, 1, 2, 4), udpDirection{Sent: 5, Received: 5, Reordered: 2}, 5},
+    {"fin gives sent count", append(probes(0, 1, 2, 5, 6, 7), udpPacket{typ: udpFin, seq: 10}),
+      udpDirection{Sent: 10, Received: 6, Lost: 4, LossPct: 40}, 6},
+    {"probe after fin ignored", append(probes(0, 1), udpPacket{typ: udpFin, seq: 2}, udpPacket{seq: 2, now: 1}),
+      udpDirection{Sent: 2, Received: 2}, 2},
+    {"wrong token", append(probes(0, 1), udpPacket{seq: 2, token: &other}), udpDirection{Sent: 2, Received: 2}, 2},
+    {"bad magic", append(probes(0), udpPacket{seq: 1, magic: "XXXX"}), udpDirection{Sent: 1, Received: 1}, 1},
+    {"truncated", append(probes(0), udpPacket{seq: 1, truncate: udpHeaderSize - 1}), udpDirection{Sent: 1, Received: 1}, 1},
+    {"seq beyond budget", append(probes(0), udpPacket{seq: 1000}), udpDirection{Sent: 1, Received: 1}, 1},
+    {"jitter", []udpPacket{{seq: 0, txTime: 0, now: 1000}, {seq: 1, txTime: 20000, now: 23000}, {seq: 2, txTime: 40000, now: 41000}},
+      udpDirection{Sent: 3, Received: 3, JitterMs: jitterMs}, 3},
+  }
+  for _, tt := range tests {
+    t.Run(tt.name, func(t *testing.T) {
+      ut := newTestUDPTest()
+      out := make([]byte, udpMaxSize)
+      reflects := 0
+      for _, pk := range tt.packets {
+        if n := ut.handle(pk.bytes(), pk.now, out); n > 0 {
+          reflects++
+          if string(out[:4]) != udpMagic || out[4] != udpReflect || n != ut.Size { t.Fatalf("bad reflect header % x (size %d)", out[:8], n) }
+          if echo := binary.BigEndian.Uint32(out[28:]); echo != pk.seq { t.Errorf("reflect echoes seq %d, want %d", echo, pk.seq) }
+        }
+      }
+      got := ut.report()["upstream"].(udpDirection)
+      if math.Abs(got.JitterMs-tt.want.JitterMs) > 1e-9 { t.Errorf("jitterMs = %v, want %v", got.JitterMs, tt.want.JitterMs) }
+      got.JitterMs = tt.want.JitterMs
+      if got != tt.want { t.Errorf("upstream = %+v, want %+v", got, tt.want) }
+      if reflects != tt.reflects { t.Errorf("reflected %d datagram(s), want %d", reflects, tt.reflects) }
+    })
+  }
+}
+
+func TestUDPHandleDownstreamFeedback(t *testing.T) {
+  ut := newTestUDPTest()
+  out := make([]byte, udpMaxSize)
+  for _, pk := range probes(0, 1, 2, 3) { ut.handle(pk.bytes(), pk.now, out) }
+  // klien menerima 3 dari 4 pantulan, 1 duplikat, 1 terbalik (nilai kumulatif, yang lebih kecil diabaikan)
+  ut.handle(udpPacket{typ: udpFin, seq: 4, fb: [3]uint32{3, 1, 1}}.bytes(), 0, out)
+  ut.handle(udpPacket{typ: udpFin, seq: 4, fb: [3]uint32{2, 0, 0}}.bytes(), 0, out)
+  down := ut.report()["downstream"].(udpDirection)
+  if down.Sent != 4 || down.Received != 3 || down.Lost != 1 || down.LossPct != 25 || down.Duplicates != 1 || down.Reordered != 1 {
+    t.Errorf("downstream = %+v", down)
+  }
+  if st := ut.report()["state"]; st != "done" { t.Errorf("state after fin = %v", st) }
+}
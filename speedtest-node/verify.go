@@ -0,0 +1,149 @@
+package main
+
+import (
+  "bytes"
+  "crypto/sha256"
+  "encoding/hex"
+  "errors"
+  "hash"
+  "hash/crc32"
+  "net/http"
+  "net/url"
+  "strconv"
+  "strings"
+)
+
+// Verifikasi integritas upload: klien memilih skema lewat verify= dan node memeriksa
+// stream yang benar-benar diterima (bukan hanya menghitung byte), supaya middlebox
+// yang memotong atau mengubah upload ketahuan.
+//
+//   verify=seed&seed=N     body = xoshiro256** (seed lewat splitmix64, sama dengan payload
+//                          download) sebagai uint64 little-endian berurutan; node tahu byte
+//                          yang seharusnya di tiap offset -> offset mismatch pertama
+//   verify=crc32c|sha256   checksum (hex) dari checksum=, header X-Checksum, atau trailer
+//                          X-Checksum (chunked, mis. curl); tanpa checksum node hanya
+//                          melaporkan nilai yang dihitungnya
+//
+// Panjang yang dijanjikan dari length= atau Content-Length dipakai untuk deteksi terpotong.
+// Kalau node sendiri yang berhenti membaca (time guard, MAX_STREAM_MB, sesi di-kill),
+// alasannya dilaporkan di stoppedBy dan upload tidak dianggap terpotong.
+
+type uploadVerifier struct {
+  scheme string
+  want   string // checksum yang diharapkan (hex, huruf kecil)
+  length int64  // -1 = tidak diketahui
+  h      hash.Hash
+
+  gen      *randomPayload // verify=seed
+  exp      []byte
+  pos      int
+  n        int64
+  firstBad int64
+  bad      int64
+
+  stoppedBy string // "time" | "bytes" | "session": node yang menghentikan stream
+}
+
+type integrityResult struct {
+  Scheme           string `json:"scheme"`
+  OK               *bool  `json:"ok,omitempty"` // kosong kalau tidak ada pembanding (checksum tanpa nilai klien)
+  ReceivedBytes    int64  `json:"receivedBytes"`
+  VerifiedBytes    int64  `json:"verifiedBytes"` // seed: prefix yang utuh; checksum: semua kalau cocok
+  ExpectedBytes    int64  `json:"expectedBytes,omitempty"`
+  Truncated        bool   `json:"truncated"`
+  StoppedBy        string `json:"stoppedBy,omitempty"`
+  TruncatedAt      *int64 `json:"truncatedAt,omitempty"`
+  MismatchedBytes  int64  `json:"mismatchedBytes,omitempty"`
+  FirstMismatchAt  *int64 `json:"firstMismatchAt,omitempty"`
+  Checksum         string `json:"checksum,omitempty"`
+  ExpectedChecksum string `json:"expectedChecksum,omitempty"`
+}
+
+var crc32c = crc32.MakeTable(crc32.Castagnoli)
+
+// newUploadVerifier: nil kalau verify= kosong. contentLength dari request (-1 untuk WS/chunked).
+func newUploadVerifier(q url.Values, h http.Header, contentLength int64) (*uploadVerifier, error) {
+  scheme := q.Get("verify")
+  if scheme == "" { return nil, nil }
+  v := &uploadVerifier{scheme: scheme, length: contentLength, firstBad: -1}
+  if s := q.Get("length"); s != "" {
+    n, err := strconv.ParseInt(s, 10, 64)
+    if err != nil || n < 0 { return nil, errors.New("length must be a non-negative integer") }
+    v.length = n
+  }
+  switch scheme {
+  case "seed":
+    seed, err := strconv.ParseUint(q.Get("seed"), 10, 64)
+    if err != nil { return nil, errors.New("verify=seed needs seed= (unsigned integer)") }
+    v.gen = newRandomPayload(seed)
+    v.exp = make([]byte, 64<<10)
+    v.pos = len(v.exp)
+    return v, nil
+  case "crc32c":
+    v.h = crc32.New(crc32c)
+  case "sha256":
+    v.h = sha256.New()
+  default:
+    return nil, errors.New("verify must be seed, crc32c or sha256")
+  }
+  v.want = strings.ToLower(firstNonEmpty(q.Get("checksum"), h.Get("X-Checksum")))
+  return v, nil
+}
+
+func (v *uploadVerifier) Write(p []byte) (int, error) {
+  if v.h != nil {
+    v.n += int64(len(p))
+    return v.h.Write(p)
+  }
+  n := len(p)
+  for len(p) > 0 {
+    if v.pos == len(v.exp) { v.gen.fill(v.exp); v.pos = 0 }
+    k := min(len(p), len(v.exp)-v.pos)
+    if exp := v.exp[v.pos : v.pos+k]; !bytes.Equal(p[:k], exp) {
+      for i := range k {
+        if p[i] == exp[i] { continue }
+        if v.firstBad < 0 { v.firstBad = v.n + int64(i) }
+        v.bad++
+      }
+    }
+    v.pos += k
+    v.n += int64(k)
+    p = p[k:]
+  }
+  return n, nil
+}
+
+// stop mencatat bahwa node menghentikan stream sebelum body habis (v boleh nil).
+func (v *uploadVerifier) stop(reason string) {
+  if v != nil && v.stoppedBy == "" { v.stoppedBy = reason }
+}
+
+// result: dipanggil setelah body habis; trailer (boleh nil) bisa membawa X-Checksum.
+func (v *uploadVerifier) result(trailer http.Header) *integrityResult {
+  if v == nil { return nil }
+  res := &integrityResult{Scheme: v.scheme, ReceivedBytes: v.n, StoppedBy: v.stoppedBy}
+  if v.length >= 0 {
+    res.ExpectedBytes = v.length
+    if v.n < v.length && v.stoppedBy == "" { res.Truncated, res.TruncatedAt = true, &v.n }
+  }
+  var ok bool
+  if v.h != nil {
+    res.Checksum = hex.EncodeToString(v.h.Sum(nil))
+    if v.stoppedBy != "" { return res } // checksum klien untuk seluruh body, tidak bisa dibandingkan
+    if v.want == "" && trailer != nil { v.want = strings.ToLower(trailer.Get("X-Checksum")) }
+    if v.want == "" && !res.Truncated { return res } // tidak ada pembanding
+    if v.want != "" {
+      res.ExpectedChecksum = v.want
+      ok = v.want == res.Checksum
+      if ok { res.VerifiedBytes = v.n }
+    }
+  } else {
+    res.VerifiedBytes, res.MismatchedBytes = v.n, v.bad
+    if v.firstBad >= 0 { res.VerifiedBytes, res.FirstMismatchAt = v.firstBad, &v.firstBad }
+    ok = v.bad == 0
+  }
+  ok = ok && !res.Truncated
+  res.OK = &ok
+  if !ok { metrics.integrityFail.Add(1) }
+  return res
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+  "crypto/sha256"
+  "encoding/hex"
+  "hash/crc32"
+  "net/http"
+  "net/url"
+  "strconv"
+  "strings"
+  "testing"
+)
+
+func seedBody(seed uint64, n int) []byte {
+  b := make([]byte, n)
+  newRandomPayload(seed).fill(b)
+  return b
+}
+
+func newTestVerifier(t *testing.T, query string, h http.Header, contentLength int64) *uploadVerifier {
+  t.Helper()
+  q, _ := url.ParseQuery(query)
+  if h == nil { h = http.Header{} }
+  v, err := newUploadVerifier(q, h, contentLength)
+  if err != nil { t.Fatalf("newUploadVerifier(%q): %v", query, err) }
+  return v
+}
+
+// writeChunks memecah body dengan ukuran ganjil supaya batas buffer verifier ikut teruji.
+func writeChunks(v *uploadVerifier, b []byte) {
+  for len(b) > 0 {
+    k := min(len(b), 10007)
+    _, _ = v.Write(b[:k])
+    b = b[k:]
+  }
+}
+
+func TestVerifySeed(t *testing.T) {
+  body := seedBody(42, 200_000)
+  v := newTestVerifier(t, "verify=seed&seed=42", nil, int64(len(body)))
+  writeChunks(v, body)
+  res := v.result(nil)
+  if res.OK == nil || !*res.OK || res.VerifiedBytes != int64(len(body)) || res.Truncated {
+    t.Fatalf("intact body: %+v", res)
+  }
+
+  bad := append([]byte(nil), body...)
+  bad[150_001] ^= 0xff
+  bad[150_005] ^= 0x01
+  v = newTestVerifier(t, "verify=seed&seed=42", nil, int64(len(bad)))
+  writeChunks(v, bad)
+  res = v.result(nil)
+  if res.OK == nil || *res.OK { t.Fatalf("corrupted body reported ok: %+v", res) }
+  if res.FirstMismatchAt == nil || *res.FirstMismatchAt != 150_001 || res.MismatchedBytes != 2 || res.VerifiedBytes != 150_001 {
+    t.Errorf("corrupted body: %+v", res)
+  }
+
+  // seed lain = semua byte berbeda
+  v = newTestVerifier(t, "verify=seed&seed=43", nil, -1)
+  writeChunks(v, body[:1000])
+  if res = v.result(nil); *res.OK || *res.FirstMismatchAt != 0 { t.Errorf("wrong seed: %+v", res) }
+}
+
+func TestVerifyChecksum(t *testing.T) {
+  body := seedBody(1, 100_000)
+  h := crc32.New(crc32c)
+  h.Write(body)
+  crc := hex.EncodeToString(h.Sum(nil))
+  sum := sha256.Sum256(body)
+  sha := hex.EncodeToString(sum[:])
+
+  tests := []struct {
+    name, query string
+    header      http.Header
+    trailer     http.Header
+    wantOK      *bool
+  }{
+    {"crc32c query", "verify=crc32c&checksum=" + crc, nil, nil, ptr(true)},
+    {"crc32c upper case", "verify=crc32c&checksum=" + strings.ToUpper(crc), nil, nil, ptr(true)},
+    {"crc32c wrong", "verify=crc32c&checksum=00000000", nil, nil, ptr(false)},
+    {"sha256 header", "verify=sha256", http.Header{"X-Checksum": {sha}}, nil, ptr(true)},
+    {"sha256 trailer", "verify=sha256", nil, http.Header{"X-Checksum": {sha}}, ptr(true)},
+    {"sha256 without checksum", "verify=sha256", nil, nil, nil},
+  }
+  for _, tt := range tests {
+    t.Run(tt.name, func(t *testing.T) {
+      v := newTestVerifier(t, tt.query, tt.header, int64(len(body)))
+      writeChunks(v, body)
+      res := v.result(tt.trailer)
+      if (res.OK == nil) != (tt.wantOK == nil) || (res.OK != nil && *res.OK != *tt.wantOK) {
+        t.Fatalf("ok = %v, want %v (%+v)", res.OK, tt.wantOK, res)
+      }
+      if res.ReceivedBytes != int64(len(body)) { t.Errorf("ReceivedBytes = %d", res.ReceivedBytes) }
+      if want := map[string]string{"crc32c": crc, "sha256": sha}[v.scheme]; res.Checksum != want {
+        t.Errorf("Checksum = %s, want %s", res.Checksum, want)
+      }
+    })
+  }
+}
+
+func TestVerifyTruncated(t *testing.T) {
+  body := seedBody(9, 50_000)
+  for _, query := range []string{"verify=seed&seed=9", "verify=sha256&checksum=00"} {
+    v := newTestVerifier(t, query+"&length="+strconv.Itoa(len(body)), nil, -1)
+    writeChunks(v, body[:30_000])
+    res := v.result(nil)
+    if !res.Truncated || res.TruncatedAt == nil || *res.TruncatedAt != 30_000 || res.OK == nil || *res.OK {
+      t.Errorf("%s: client ended early: %+v", query, res)
+    }
+  }
+}
+
+func TestVerifyStoppedByServer(t *testing.T) {
+  body := seedBody(9, 50_000)
+  v := newTestVerifier(t, "verify=seed&seed=9", nil, int64(len(body)))
+  writeChunks(v, body[:30_000])
+  v.stop("bytes")
+  v.stop("time") // alasan pertama yang dipakai
+  res := v.result(nil)
+  if res.Truncated || res.StoppedBy != "bytes" || res.OK == nil || !*res.OK || res.VerifiedBytes != 30_000 {
+    t.Errorf("seed stopped by node: %+v", res)
+  }
+
+  v = newTestVerifier(t, "verify=crc32c&checksum=12345678", nil, int64(len(body)))
+  writeChunks(v, body[:30_000])
+  v.stop("time")
+  if res = v.result(nil); res.Truncated || res.OK != nil || res.StoppedBy != "time" {
+    t.Errorf("checksum stopped by node: %+v", res)
+  }
+
+  (*uploadVerifier)(nil).stop("time") // nil-safe
+}
+
+func TestNewUploadVerifierErrors(t *testing.T) {
+  if v, err := newUploadVerifier(url.Values{}, http.Header{}, 10); v != nil || err != nil { t.Errorf("no verify= : %v, %v", v, err) }
+  for _, query := range []string{"verify=md5", "verify=seed", "verify=seed&seed=-1", "verify=crc32c&length=-5", "verify=sha256&length=x"} {
+    q, _ := url.ParseQuery(query)
+    if _, err := newUploadVerifier(q, http.Header{}, -1); err == nil { t.Errorf("%s: no error", query) }
+  }
+}
+
+func ptr(b bool) *bool { return &b }
@@ -0,0 +1,57 @@
+package main
+
+import (
+  "encoding/json"
+  "io/fs"
+  "log"
+  "net/http"
+  "strings"
+)
+
+// Web client (../client) disajikan langsung dari node: satu binary, same-origin, jadi
+// tidak perlu container nginx terpisah maupun CORS/Private Network Access ke 192.168.x.x.
+// Ikut ter-embed hanya kalau dibangun dengan `-tags webui` (webui_embed.go); WEBUI=0
+// mematikannya saat runtime. Pengaturan app.js disajikan di /config.json, bukan hardcode.
+
+var webuiFS fs.FS // nil tanpa tag webui
+
+type webuiConfig struct {
+  DirectoryURL   string `json:"directoryUrl"` // kosong = tes ke node ini saja
+  DefaultSeconds int    `json:"defaultSeconds"`
+  DefaultStreams int    `json:"defaultStreams"`
+  MaxSeconds     int    `json:"maxSeconds"`
+  MaxStreams     int    `json:"maxStreams"`
+}
+
+func registerWebUI(mux *http.ServeMux) {
+  if webuiFS == nil || getenv("WEBUI", "1") == "0" { return }
+  mux.HandleFunc("/config.json", func(w http.ResponseWriter, r *http.Request) {
+    // dibaca tiap request: limits bisa diubah lewat admin API, webui.* lewat reload CONFIG_FILE
+    l := limits.Load()
+    cfg := webuiConfig{
+      DirectoryURL:   webuiDirectory(),
+      DefaultSeconds: getenvInt("WEBUI_DEFAULT_SECONDS", 10),
+      DefaultStreams: getenvInt("WEBUI_DEFAULT_STREAMS", 8),
+      MaxSeconds:     l.MaxDurationSec,
+      MaxStreams:     l.MaxStreams,
+    }
+    cfg.DefaultSeconds = min(cfg.DefaultSeconds, l.MaxDurationSec)
+    cfg.DefaultStreams = min(cfg.DefaultStreams, l.MaxStreams)
+    w.Header().Set("Content-Type", "application/json")
+    w.Header().Set("Cache-Control", "no-store")
+    _ = json.NewEncoder(w).Encode(cfg)
+  })
+  files := http.FileServerFS(webuiFS)
+  mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+    w.Header().Set("Cache-Control", "no-store") // sama dengan nginx.conf client
+    files.ServeHTTP(w, r)
+  })
+  addCapability("webui")
+  dir := webuiDirectory()
+  if dir == "" { dir = "this node only" }
+  log.Printf("serving web client on / (directory: %s)", dir)
+}
+
+func webuiDirectory() string {
+  return strings.TrimRight(getenv("WEBUI_DIRECTORY_URL", getenv("DIRECTORY_URL", "")), "/")
+}
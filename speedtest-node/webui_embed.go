@@ -0,0 +1,16 @@
+//go:build webui
+
+package main
+
+import (
+  "embed"
+  "io/fs"
+)
+
+// webui/ disalin dari ../client saat build: `go generate -tags webui` (lokal) atau Dockerfile.
+//go:generate sh -c "mkdir -p webui && cp ../client/index.html ../client/app.js ../client/styles.css webui/"
+
+//go:embed webui
+var webuiEmbed embed.FS
+
+func init() { webuiFS, _ = fs.Sub(webuiEmbed, "webui") }
@@ -0,0 +1,182 @@
+package main
+
+import (
+  "encoding/json"
+  "fmt"
+  "log"
+  "net"
+  "net/http"
+  "strconv"
+  "strings"
+  "sync/atomic"
+
+  "github.com/oschwald/maxminddb-golang"
+)
+
+// /api/v1/whoami: IP klien + ASN/org/lokasi dari file .mmdb lokal (MaxMind GeoLite2
+// City/ASN atau format IPinfo), supaya klien tidak perlu memanggil ipapi/ipify.
+//   GEOIP_DB         .mmdb lokasi (GeoLite2-City / IPinfo location / country_asn)
+//   ASN_DB           .mmdb ASN (GeoLite2-ASN / IPinfo asn); boleh kosong kalau GEOIP_DB sudah berisi ASN
+//   TRUSTED_PROXIES  CIDR/IP reverse proxy yang X-Forwarded-For / X-Real-IP-nya dipercaya
+
+type whoamiInfo struct {
+  IP          string   `json:"ip"`
+  Family      string   `json:"family"` // "ipv4" | "ipv6"
+  ASN         uint64   `json:"asn,omitempty"`
+  Org         string   `json:"org,omitempty"`
+  Country     string   `json:"country,omitempty"` // ISO 3166-1 alpha-2
+  CountryName string   `json:"countryName,omitempty"`
+  Region      string   `json:"region,omitempty"`
+  City        string   `json:"city,omitempty"`
+  Lat         *float64 `json:"lat,omitempty"`
+  Lon         *float64 `json:"lon,omitempty"`
+  CGNAT       bool     `json:"cgnat"`   // 100.64.0.0/10 (RFC 6598)
+  Private     bool     `json:"private"` // RFC 1918 / ULA / loopback / link-local
+}
+
+var (
+  geoDBs         []*maxminddb.Reader
+  trustedProxies atomic.Pointer[[]*net.IPNet] // bisa diganti saat config reload
+  cgnatNet       = &net.IPNet{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)}
+)
+
+func loadGeoDBs() {
+  for _, env := range []string{"GEOIP_DB", "ASN_DB"} {
+    path := getenv(env, "")
+    if path == "" { continue }
+    db, err := maxminddb.Open(path)
+    if err != nil { log.Fatalf("%s: %v", env, err) }
+    geoDBs = append(geoDBs, db)
+    log.Printf("%s: %s (%s)", env, path, db.Metadata.DatabaseType)
+  }
+}
+
+func parseTrustedProxies(list string) ([]*net.IPNet, error) {
+  var out []*net.IPNet
+  for _, s := range strings.Split(list, ",") {
+    s = strings.TrimSpace(s)
+    if s == "" { continue }
+    if !strings.Contains(s, "/") {
+      if strings.Contains(s, ":") { s += "/128" } else { s += "/32" }
+    }
+    _, n, err := net.ParseCIDR(s)
+    if err != nil { return nil, err }
+    out = append(out, n)
+  }
+  return out, nil
+}
+
+func loadTrustedProxies(list string) {
+  nets, err := parseTrustedProxies(list)
+  if err != nil { log.Fatalf("TRUSTED_PROXIES: %v", err) }
+  trustedProxies.Store(&nets)
+}
+
+func isTrustedProxy(ip net.IP) bool {
+  nets := trustedProxies.Load()
+  if nets == nil { return false }
+  for _, n := range *nets {
+    if n.Contains(ip) { return true }
+  }
+  return false
+}
+
+// forwardedClient: hop paling kanan di X-Forwarded-For yang bukan proxy tepercaya,
+// lalu X-Real-IP. Hanya dipanggil kalau peer langsungnya proxy tepercaya.
+func forwardedClient(r *http.Request) string {
+  var hops []string
+  for _, h := range r.Header.Values("X-Forwarded-For") {
+    for _, p := range strings.Split(h, ",") {
+      if p = strings.TrimSpace(p); p != "" { hops = append(hops, p) }
+    }
+  }
+  for i := len(hops) - 1; i >= 0; i-- {
+    ip := net.ParseIP(hops[i])
+    if ip == nil { break }
+    if !isTrustedProxy(ip) || i == 0 { return ip.String() }
+  }
+  if ip := net.ParseIP(strings.TrimSpace(r.Header.Get("X-Real-IP"))); ip != nil { return ip.String() }
+  return ""
+}
+
+func lookupWhoami(ipStr string) whoamiInfo {
+  ip := net.ParseIP(ipStr)
+  out := whoamiInfo{IP: ipStr, Family: "ipv6"}
+  if ip == nil { return out }
+  if ip.To4() != nil { out.Family = "ipv4" }
+  out.CGNAT = cgnatNet.Contains(ip)
+  out.Private = ip.IsPrivate() || ip.IsLoopback() || ip.IsLinkLocalUnicast()
+  if out.CGNAT || out.Private { return out }
+
+  for _, db := range geoDBs {
+    var rec map[string]any
+    if err := db.Lookup(ip, &rec); err != nil || rec == nil { continue }
+    // MaxMind dulu, lalu nama field IPinfo
+    if v, ok := rec["autonomous_system_number"].(uint64); ok && out.ASN == 0 { out.ASN = v }
+    if s, ok := rec["asn"].(string); ok && out.ASN == 0 {
+      out.ASN, _ = strconv.ParseUint(strings.TrimPrefix(strings.ToUpper(s), "AS"), 10, 64)
+    }
+    out.Org = firstNonEmpty(out.Org, mmString(rec, "autonomous_system_organization"), mmString(rec, "as_name"), mmString(rec, "name"))
+    out.Country = firstNonEmpty(out.Country, mmString(rec, "country", "iso_code"), mmString(rec, "country"))
+    out.CountryName = firstNonEmpty(out.CountryName, mmString(rec, "country", "names", "en"), mmString(rec, "country_name"))
+    out.City = firstNonEmpty(out.City, mmString(rec, "city", "names", "en"), mmString(rec, "city"))
+    out.Region = firstNonEmpty(out.Region, mmString(rec, "region"))
+    if subs, ok := rec["subdivisions"].([]any); ok && len(subs) > 0 && out.Region == "" {
+      if sub, ok := subs[0].(map[string]any); ok { out.Region = mmString(sub, "names", "en") }
+    }
+    if out.Lat == nil {
+      if lat, ok := mmFloat(rec, "location", "latitude"); ok { out.Lat = &lat } else if lat, ok := mmFloat(rec, "lat"); ok { out.Lat = &lat }
+    }
+    if out.Lon == nil {
+      if lon, ok := mmFloat(rec, "location", "longitude"); ok { out.Lon = &lon } else if lon, ok := mmFloat(rec, "lng"); ok { out.Lon = &lon }
+    }
+  }
+  return out
+}
+
+func mmValue(m map[string]any, path ...string) any {
+  var v any = m
+  for _, k := range path {
+    mm, ok := v.(map[string]any)
+    if !ok { return nil }
+    v = mm[k]
+  }
+  return v
+}
+
+func mmString(m map[string]any, path ...string) string {
+  s, _ := mmValue(m, path...).(string)
+  return s
+}
+
+func mmFloat(m map[string]any, path ...string) (float64, bool) {
+  switch v := mmValue(m, path...).(type) {
+  case float64:
+    return v, true
+  case float32:
+    return float64(v), true
+  case string: // IPinfo menyimpan lat/lng sebagai string
+    f, err := strconv.ParseFloat(v, 64)
+    return f, err == nil
+  }
+  return 0, false
+}
+
+func firstNonEmpty(vals ...string) string {
+  for _, v := range vals {
+    if v != "" { return v }
+  }
+  return ""
+}
+
+// orgLabel: "AS7713 PT Telekomunikasi Indonesia" (format org ipinfo.io).
+func (wi whoamiInfo) orgLabel() string {
+  if wi.ASN == 0 { return wi.Org }
+  return strings.TrimSpace(fmt.Sprintf("AS%d %s", wi.ASN, wi.Org))
+}
+
+func apiWhoami(w http.ResponseWriter, r *http.Request) {
+  w.Header().Set("Content-Type", "application/json")
+  w.Header().Set("Cache-Control", "no-store")
+  _ = json.NewEncoder(w).Encode(lookupWhoami(clientIP(r)))
+}
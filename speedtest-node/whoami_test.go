@@ -0,0 +1,73 @@
+package main
+
+import (
+  "net/http/httptest"
+  "testing"
+)
+
+func setTrustedProxies(t *testing.T, list string) {
+  t.Helper()
+  nets, err := parseTrustedProxies(list)
+  if err != nil { t.Fatal(err) }
+  old := trustedProxies.Load()
+  trustedProxies.Store(&nets)
+  t.Cleanup(func() { trustedProxies.Store(old) })
+}
+
+func TestClientIPForwarded(t *testing.T) {
+  setTrustedProxies(t, "10.0.0.0/8, 192.168.1.1, fd00::/8")
+  tests := []struct {
+    name   string
+    peer   string
+    xff    []string // satu elemen per header
+    realIP string
+    want   string
+  }{
+    {"no proxy", "203.0.113.9:5000", nil, "", "203.0.113.9"},
+    {"untrusted peer XFF ignored", "203.0.113.9:5000", []string{"1.1.1.1"}, "2.2.2.2", "203.0.113.9"},
+    {"trusted proxy", "10.0.0.1:5000", []string{"203.0.113.5"}, "", "203.0.113.5"},
+    {"spoofed left-most hop", "10.0.0.1:5000", []string{"1.1.1.1, 203.0.113.5"}, "", "203.0.113.5"},
+    {"chained trusted proxies", "10.0.0.1:5000", []string{"1.1.1.1, 203.0.113.5, 192.168.1.1, 10.2.3.4"}, "", "203.0.113.5"},
+    {"chain over multiple headers", "10.0.0.1:5000", []string{"1.1.1.1, 203.0.113.5", "10.9.9.9"}, "", "203.0.113.5"},
+    {"only trusted hops: left-most", "10.0.0.1:5000", []string{"10.1.1.1, 10.2.2.2"}, "", "10.1.1.1"},
+    {"X-Real-IP fallback", "10.0.0.1:5000", nil, " 203.0.113.7 ", "203.0.113.7"},
+    {"IPv6 proxy", "[fd00::1]:5000", []string{"2001:db8::5"}, "", "2001:db8::5"},
+    {"malformed right-most hop: X-Real-IP", "10.0.0.1:5000", []string{"1.1.1.1, garbage"}, "203.0.113.7", "203.0.113.7"},
+    {"malformed right-most hop: peer", "10.0.0.1:5000", []string{"1.1.1.1, garbage"}, "", "10.0.0.1"},
+    {"malformed hop left of client", "10.0.0.1:5000", []string{"garbage, 203.0.113.5"}, "", "203.0.113.5"},
+    {"hop with port is malformed", "10.0.0.1:5000", []string{"203.0.113.5:1234"}, "", "10.0.0.1"},
+    {"malformed X-Real-IP", "10.0.0.1:5000", nil, "not-an-ip", "10.0.0.1"},
+    {"empty entries", "10.0.0.1:5000", []string{" , 203.0.113.5 ,, "}, "", "203.0.113.5"},
+  }
+  for _, tt := range tests {
+    t.Run(tt.name, func(t *testing.T) {
+      r := httptest.NewRequest("GET", "/", nil)
+      r.RemoteAddr = tt.peer
+      for _, h := range tt.xff { r.Header.Add("X-Forwarded-For", h) }
+      if tt.realIP != "" { r.Header.Set("X-Real-IP", tt.realIP) }
+      if got := clientIP(r); got != tt.want { t.Errorf("clientIP = %q, want %q", got, tt.want) }
+    })
+  }
+}
+
+func TestClientIPNoTrustedProxies(t *testing.T) {
+  setTrustedProxies(t, "")
+  r := httptest.NewRequest("GET", "/", nil)
+  r.RemoteAddr = "10.0.0.1:5000"
+  r.Header.Set("X-Forwarded-For", "1.1.1.1")
+  r.Header.Set("X-Real-IP", "2.2.2.2")
+  if got := clientIP(r); got != "10.0.0.1" { t.Errorf("clientIP = %q, want peer when TRUSTED_PROXIES is empty", got) }
+}
+
+func TestParseTrustedProxies(t *testing.T) {
+  nets, err := parseTrustedProxies(" 10.0.0.0/8 , 192.168.1.1,,2001:db8::1 ")
+  if err != nil { t.Fatal(err) }
+  want := []string{"10.0.0.0/8", "192.168.1.1/32", "2001:db8::1/128"}
+  if len(nets) != len(want) { t.Fatalf("nets = %v", nets) }
+  for i, n := range nets {
+    if n.String() != want[i] { t.Errorf("nets[%d] = %s, want %s", i, n, want[i]) }
+  }
+  for _, bad := range []string{"10.0.0.0/33", "proxy.local", "1.2.3"} {
+    if _, err := parseTrustedProxies(bad); err == nil { t.Errorf("parseTrustedProxies(%q) succeeded", bad) }
+  }
+}
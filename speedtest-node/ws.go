@@ -0,0 +1,398 @@
+package main
+
+import (
+  "context"
+  "encoding/json"
+  "io"
+  "math"
+  "net"
+  "net/http"
+  "net/url"
+  "sort"
+  "strconv"
+  "strings"
+  "sync"
+  "sync/atomic"
+  "time"
+
+  "github.com/gorilla/websocket"
+)
+
+// WebSocket: /api/v1/ws?mode=latency|download|upload (dan /api/v1/sessions/{id}/ws).
+//
+//   latency   server kirim {"type":"ping","seq"} tiap interval, klien balas {"type":"pong","seq"},
+//             server hitung RTT sendiri. Klien juga boleh kirim {"type":"ping","seq","t"} dan
+//             dapat {"type":"pong",...,"serverRecvUs","serverSendUs"}. Lewat sesi tanpa count=,
+//             ping jalan terus (maks 3x MAX_DURATION_SEC) selama fase idle, download dan
+//             upload; RTT-nya dicatat per fase di hasil sesi (loaded latency / bufferbloat).
+//   download  pesan biner berisi payload sampai time/bytes habis, lalu {"type":"done"}.
+//   upload    klien kirim pesan biner; server kirim {"type":"progress"} tiap 250ms dan
+//             {"type":"result"} setelah {"type":"done"} dari klien atau waktu habis.
+
+var wsUpgrader = websocket.Upgrader{
+  ReadBufferSize:  64 << 10,
+  WriteBufferSize: 64 << 10,
+  CheckOrigin:     wsCheckOrigin,
+}
+
+// wsCheckOrigin: allow-list yang sama dengan CORS HTTP (CORS_ORIGINS). Tanpa Origin = klien
+// non-browser; origin node sendiri (web client embed) selalu boleh.
+func wsCheckOrigin(r *http.Request) bool {
+  origin := r.Header.Get("Origin")
+  if origin == "" || corsAllowed(origin) { return true }
+  u, err := url.Parse(origin)
+  return err == nil && strings.EqualFold(u.Host, r.Host)
+}
+
+type wsMsg struct {
+  Type string  `json:"type"`
+  Seq  int64   `json:"seq"`
+  T    float64 `json:"t,omitempty"` // timestamp klien, dikembalikan apa adanya
+}
+
+// wsConn: gorilla hanya mengizinkan satu writer sekaligus.
+type wsConn struct {
+  *websocket.Conn
+  wmu sync.Mutex
+  imp *impairment // nil = tanpa impairment
+}
+
+func (c *wsConn) writeJSON(v any) error {
+  c.wmu.Lock()
+  defer c.wmu.Unlock()
+  return c.WriteJSON(v)
+}
+
+func unixMicro() int64 { return time.Now().UnixMicro() }
+
+func queryInt(q url.Values, k string, def, lo, hi int) int {
+  n, err := strconv.Atoi(q.Get(k))
+  if err != nil { n = def }
+  return min(hi, max(lo, n))
+}
+
+func apiWS(w http.ResponseWriter, r *http.Request) { serveWS(w, r, nil) }
+
+func apiSessionWS(w http.ResponseWriter, r *http.Request) {
+  ss := sessions.get(r.PathValue("id"))
+  if ss == nil { http.Error(w, "session not found", http.StatusNotFound); return }
+  serveWS(w, r, ss)
+}
+
+func serveWS(w http.ResponseWriter, r *http.Request, ss *session) {
+  q := r.URL.Query()
+  mode := q.Get("mode")
+  if mode == "" { mode = "latency" }
+  var gen payload
+  switch mode {
+  case "latency", "upload":
+  case "download":
+    var err error
+    if gen, err = newPayload(q.Get("pattern")); err != nil {
+      http.Error(w, err.Error(), http.StatusBadRequest)
+      return
+    }
+  default:
+    http.Error(w, "mode must be latency, download or upload", http.StatusBadRequest)
+    return
+  }
+  imp, err := requestImpairment(q, ss)
+  if err != nil { http.Error(w, err.Error(), http.StatusBadRequest); return }
+  var verifier *uploadVerifier
+  if mode == "upload" {
+    if verifier, err = newUploadVerifier(q, r.Header, -1); err != nil { http.Error(w, err.Error(), http.StatusBadRequest); return }
+  }
+
+  // latency tidak makan slot stream; download/upload sama seperti HTTP
+  ip := clientIP(r)
+  if mode != "latency" {
+    if ss == nil && refusingTests() { rejectDraining(w); return }
+    if !admit.acquire(ip) { rejectBusy(w); return }
+    defer admit.release(ip)
+  }
+  quotaLeft := int64(-1)
+  if mode == "download" {
+    var ok bool
+    if quotaLeft, ok = quota.admitDownload(w, ip); !ok { return }
+  }
+
+  c, err := wsUpgrader.Upgrade(w, r, nil)
+  if err != nil { return } // upgrader sudah menulis respons error
+  conn := &wsConn{Conn: c, imp: imp}
+  defer conn.Close()
+  if ss != nil {
+    stop := context.AfterFunc(ss.ctx, func() { _ = conn.Close() }) // sesi di-kill
+    defer stop()
+  }
+
+  switch mode {
+  case "latency":
+    wsLatency(conn, q, ss)
+  case "download":
+    wsDownload(conn, q, gen, ss, ip, quotaLeft)
+  case "upload":
+    wsUpload(conn, q, ss, verifier)
+  }
+  _ = conn.WriteControl(websocket.CloseMessage,
+    websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""), time.Now().Add(time.Second))
+}
+
+// ---------- latency ----------
+
+// latencyStats: ringkasan sampel RTT dalam ms.
+type latencyStats struct {
+  Count  int     `json:"count"`
+  MinMs  float64 `json:"minMs"`
+  AvgMs  float64 `json:"avgMs"`
+  P50Ms  float64 `json:"p50Ms"`
+  P90Ms  float64 `json:"p90Ms"`
+  P99Ms  float64 `json:"p99Ms"`
+  MaxMs  float64 `json:"maxMs"`
+  Jitter float64 `json:"jitterMs"` // rata-rata |selisih| sampel berurutan
+}
+
+func summarizeRTT(samples []time.Duration) latencyStats {
+  if len(samples) == 0 { return latencyStats{} }
+  ms := make([]float64, len(samples))
+  var sum, jit float64
+  for i, d := range samples {
+    ms[i] = float64(d) / 1e6
+    sum += ms[i]
+    if i > 0 { jit += math.Abs(ms[i] - ms[i-1]) }
+  }
+  st := latencyStats{Count: len(ms), AvgMs: sum / float64(len(ms))}
+  if len(ms) > 1 { st.Jitter = jit / float64(len(ms)-1) }
+  sort.Float64s(ms)
+  pct := func(p float64) float64 { return ms[int(math.Ceil(p*float64(len(ms))))-1] }
+  st.MinMs, st.MaxMs = ms[0], ms[len(ms)-1]
+  st.P50Ms, st.P90Ms, st.P99Ms = pct(0.5), pct(0.9), pct(0.99)
+  return st
+}
+
+type wsPing struct {
+  sent  time.Time
+  phase string
+}
+
+func wsLatency(conn *wsConn, q url.Values, ss *session) {
+  count := queryInt(q, "count", 20, 0, 1000)
+  interval := time.Duration(queryInt(q, "interval", 100, 10, 5000)) * time.Millisecond
+  timeSec, _ := strconv.ParseInt(q.Get("time"), 10, 64)
+  life := clampDuration(timeSec)
+  continuous := ss != nil && q.Get("count") == ""
+  if continuous {
+    // satu kanal untuk idle + download + upload
+    life = time.Duration(limits.Load().MaxDurationSec) * 3 * time.Second
+    if timeSec > 0 { life = min(life, time.Duration(timeSec)*time.Second) }
+  }
+  _ = conn.SetReadDeadline(time.Now().Add(life + 2*time.Second)) // + tunggu pong terakhir
+
+  var mu sync.Mutex
+  pending := map[int64]wsPing{}
+  var rtts []time.Duration
+  gotAll := make(chan struct{})
+
+  readerDone := make(chan struct{})
+  go func() {
+    defer close(readerDone)
+    for {
+      var m wsMsg
+      if err := conn.ReadJSON(&m); err != nil { return }
+      recv := unixMicro()
+      switch m.Type {
+      case "ping": // RTT diukur klien, server memberi timestamp
+        if d := conn.imp.delay(); d > 0 { // delay dianggap terjadi di jaringan, sebelum ping tiba
+          time.AfterFunc(d, func() {
+            recv := unixMicro()
+            _ = conn.writeJSON(map[string]any{"type": "pong", "seq": m.Seq, "t": m.T, "serverRecvUs": recv, "serverSendUs": unixMicro()})
+          })
+          continue
+        }
+        _ = conn.writeJSON(map[string]any{"type": "pong", "seq": m.Seq, "t": m.T, "serverRecvUs": recv, "serverSendUs": unixMicro()})
+      case "pong": // balasan untuk ping server
+        mu.Lock()
+        p, ok := pending[m.Seq]
+        delete(pending, m.Seq)
+        rtt := time.Since(p.sent)
+        if ok { rtts = append(rtts, rtt) }
+        done := ok && len(rtts) == count
+        mu.Unlock()
+        if !ok { continue }
+        if ss != nil { ss.addRTT(p.phase, rtt) }
+        _ = conn.writeJSON(map[string]any{"type": "rtt", "seq": m.Seq, "rttUs": rtt.Microseconds(), "phase": p.phase})
+        if done { close(gotAll) }
+      }
+    }
+  }()
+
+  if count == 0 { // mode pasif: hanya menjawab ping klien
+    <-readerDone
+    return
+  }
+  end := time.Now().Add(life)
+  for seq := int64(1); (continuous || seq <= int64(count)) && time.Now().Before(end); seq++ {
+    p := wsPing{sent: time.Now(), phase: "idle"}
+    if ss != nil { p.phase = ss.phase() }
+    mu.Lock()
+    pending[seq] = p
+    mu.Unlock()
+    if d := conn.imp.delay(); d > 0 { // RTT = delay + jaringan sebenarnya
+      seq := seq
+      time.AfterFunc(d, func() { _ = conn.writeJSON(map[string]any{"type": "ping", "seq": seq, "serverSendUs": unixMicro()}) })
+    } else if err := conn.writeJSON(map[string]any{"type": "ping", "seq": seq, "serverSendUs": unixMicro()}); err != nil {
+      return
+    }
+    select {
+    case <-readerDone:
+      return
+    case <-time.After(interval):
+    }
+  }
+  select { // tunggu pong terakhir sebentar
+  case <-gotAll:
+  case <-readerDone:
+  case <-time.After(2 * time.Second):
+  }
+  mu.Lock()
+  sum := map[string]any{"type": "summary", "sent": count, "rtt": summarizeRTT(rtts)}
+  if continuous { sum["sent"] = len(rtts) + len(pending) }
+  mu.Unlock()
+  if ss != nil {
+    ss.mu.Lock()
+    sum["phases"] = ss.latencySummary()
+    ss.mu.Unlock()
+  }
+  _ = conn.writeJSON(sum)
+}
+
+// ---------- download ----------
+
+// quotaLeft: sisa budget egress untuk klien ini (-1 = tanpa batas).
+func wsDownload(conn *wsConn, q url.Values, gen payload, ss *session, ip string, quotaLeft int64) {
+  timeSec, _ := strconv.ParseInt(q.Get("time"), 10, 64)
+  bytesTarget, _ := strconv.ParseInt(q.Get("bytes"), 10, 64)
+  start := time.Now()
+  deadline := start.Add(clampDuration(timeSec))
+  bytesTarget = clampBytes(bytesTarget)
+  if quotaLeft >= 0 { bytesTarget = min(bytesTarget, quotaLeft) }
+
+  bufp := chunkPool.Get().(*[]byte)
+  defer chunkPool.Put(bufp)
+  buf := (*bufp)[:queryInt(q, "size", 256<<10, 1<<10, payloadChunkSize)]
+  conn.imp.wait()
+
+  // reader: deteksi klien menutup koneksi
+  closed := make(chan struct{})
+  go func() {
+    defer close(closed)
+    for {
+      if _, _, err := conn.NextReader(); err != nil { return }
+    }
+  }()
+
+  var st *streamStat
+  if ss != nil {
+    st = ss.beginStream("download")
+    defer func() { ss.endStream(st, connTCPInfo(conn.NetConn())) }()
+  }
+  metrics.activeDown.Add(1)
+  defer metrics.activeDown.Add(-1)
+
+  var sent int64
+loop:
+  for time.Now().Before(deadline) && sent < bytesTarget {
+    select {
+    case <-closed:
+      break loop
+    default:
+    }
+    gen.fill(buf)
+    allowed := quota.add(ip, len(buf))
+    if allowed == 0 { break } // budget/kuota habis
+    conn.wmu.Lock()
+    err := conn.WriteMessage(websocket.BinaryMessage, buf[:allowed])
+    conn.wmu.Unlock()
+    if err != nil { break }
+    sent += int64(allowed)
+    metrics.bytesSent.Add(int64(allowed))
+    if st != nil { ss.add(st, allowed) }
+    if allowed < len(buf) { break }
+    if conn.imp.step(allowed) != nil { resetConn(conn.NetConn()); return }
+  }
+  _ = conn.writeJSON(map[string]any{"type": "done", "sentBytes": sent, "durationMs": time.Since(start).Milliseconds()})
+}
+
+// ---------- upload ----------
+
+type countingWriter struct {
+  n  atomic.Int64 // dibaca goroutine progress
+  fn func(n int) error
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+  c.n.Add(int64(len(p)))
+  return len(p), c.fn(len(p))
+}
+
+// v (boleh nil): verify= atas gabungan isi pesan biner.
+func wsUpload(conn *wsConn, q url.Values, ss *session, v *uploadVerifier) {
+  timeSec, _ := strconv.ParseInt(q.Get("time"), 10, 64)
+  conn.imp.wait()
+  start := time.Now()
+  _ = conn.SetReadDeadline(start.Add(clampDuration(timeSec) + time.Second))
+  conn.SetReadLimit(16 << 20)
+  maxBytes := clampBytes(0)
+
+  var st *streamStat
+  if ss != nil {
+    st = ss.beginStream("upload")
+    defer func() { ss.endStream(st, connTCPInfo(conn.NetConn())) }()
+  }
+  metrics.activeUp.Add(1)
+  defer metrics.activeUp.Add(-1)
+
+  cw := &countingWriter{fn: func(n int) error {
+    metrics.bytesReceived.Add(int64(n))
+    if st != nil { ss.add(st, n) }
+    return conn.imp.step(n)
+  }}
+
+  stop := make(chan struct{})
+  go func() {
+    t := time.NewTicker(250 * time.Millisecond)
+    defer t.Stop()
+    for {
+      select {
+      case <-stop:
+        return
+      case <-t.C:
+        _ = conn.writeJSON(map[string]any{"type": "progress", "receivedBytes": cw.n.Load(), "elapsedMs": time.Since(start).Milliseconds()})
+      }
+    }
+  }()
+
+  var dst io.Writer = cw
+  if v != nil { dst = io.MultiWriter(v, cw) }
+  buf := make([]byte, 64<<10)
+  for {
+    if cw.n.Load() >= maxBytes { v.stop("bytes"); break }
+    mt, rd, err := conn.NextReader()
+    if err != nil {
+      if ne, ok := err.(net.Error); ok && ne.Timeout() { v.stop("time") }
+      break
+    }
+    if mt == websocket.TextMessage {
+      var m wsMsg
+      if json.NewDecoder(rd).Decode(&m) == nil && m.Type == "done" { break }
+      continue
+    }
+    if _, err := io.CopyBuffer(dst, rd, buf); err != nil {
+      if err == errImpairReset { close(stop); resetConn(conn.NetConn()); return }
+      break
+    }
+  }
+  close(stop)
+  res := map[string]any{"type": "result", "receivedBytes": cw.n.Load(), "durationMs": time.Since(start).Milliseconds()}
+  if in := v.result(nil); in != nil { res["integrity"] = in }
+  _ = conn.writeJSON(res)
+}